@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+//bench items besides the hash algorithms
+const (
+	benchRandom = "random"
+	benchSeeded = "seeded"
+)
+
+type (
+	//BenchResult is how fast one content source generates or one hash algorithm hashes, without the disk
+	BenchResult struct {
+		Name           string `json:"name"`
+		BytesPerSecond int64  `json:"bytes_per_second"`
+	}
+)
+
+//BenchCmd measures the random and the seeded content and every hash algorithm with workers goroutines
+//for duration each, to tell whether the CPU or the drive limits a run
+func BenchCmd(ctx context.Context, duration time.Duration, workers int, bufSize int) []*BenchResult {
+	items := append([]string{benchRandom, benchSeeded}, hashNames()...)
+	results := make([]*BenchResult, 0, len(items))
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+
+		processed := benchItem(ctx, item, duration, workers, bufSize)
+		results = append(results, &BenchResult{Name: item, BytesPerSecond: bytesPerSecond(processed, duration)})
+	}
+
+	return results
+}
+
+//benchItem runs item for duration, returns the bytes processed
+func benchItem(ctx context.Context, item string, duration time.Duration, workers int, bufSize int) int64 {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var processed int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, bufSize)
+			random := newRandomStream()
+			random.Fill(buf)
+			seeded := NewSeededContent(42, "bench")
+
+			var process func(offset int64)
+			switch item {
+			case benchRandom:
+				process = func(int64) { random.Fill(buf) }
+			case benchSeeded:
+				process = func(offset int64) { seeded.Fill(buf, offset) }
+			default:
+				h := hashAlgorithms[item]()
+				process = func(int64) { h.Write(buf) }
+			}
+
+			offset := int64(0)
+			for ctx.Err() == nil {
+				process(offset)
+				offset += int64(bufSize)
+			}
+			atomic.AddInt64(&processed, offset)
+		}()
+	}
+	wg.Wait()
+
+	return processed
+}
+
+func printBench(w io.Writer, results []*BenchResult) {
+	for _, result := range results {
+		fmt.Fprintf(w, "  %-8s %s/s\n", result.Name, sizeFormat.ToString(result.BytesPerSecond))
+	}
+}
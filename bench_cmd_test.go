@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBenchCmd(t *testing.T) {
+	results := BenchCmd(context.Background(), 10*time.Millisecond, 2, 4096)
+	if len(results) != 2+len(hashNames()) {
+		t.Fatal("expected every content source and hash, got", len(results))
+	}
+
+	for _, result := range results {
+		if result.BytesPerSecond <= 0 {
+			t.Error(result.Name, "processed nothing")
+		}
+	}
+
+	var out bytes.Buffer
+	printBench(&out, results)
+	if !strings.Contains(out.String(), benchSeeded) {
+		t.Error("unexpected output", out.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if results := BenchCmd(ctx, time.Second, 1, 4096); len(results) != 0 {
+		t.Error("expected no results once cancelled, got", len(results))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+const checksumBlockSize = 1 * sizeFormat.MB
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+type (
+	//blockChecksummer is a writer calculating a CRC32C checksum of every checksumBlockSize block written to it
+	blockChecksummer struct {
+		current hash.Hash32
+		filled  int64
+		sums    []uint32
+	}
+)
+
+func newBlockChecksummer() *blockChecksummer {
+	return &blockChecksummer{
+		current: crc32.New(castagnoliTable),
+		sums:    make([]uint32, 0),
+	}
+}
+
+func (bc *blockChecksummer) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := int64(len(p))
+		if n > checksumBlockSize-bc.filled {
+			n = checksumBlockSize - bc.filled
+		}
+
+		bc.current.Write(p[:n])
+		bc.filled += n
+		p = p[n:]
+
+		if bc.filled == checksumBlockSize {
+			bc.sums = append(bc.sums, bc.current.Sum32())
+			bc.current.Reset()
+			bc.filled = 0
+		}
+	}
+
+	return written, nil
+}
+
+//Sums returns the checksums of all blocks written so far, the last one possibly partial
+func (bc *blockChecksummer) Sums() []uint32 {
+	if bc.filled > 0 {
+		return append(bc.sums, bc.current.Sum32())
+	}
+
+	return bc.sums
+}
+
+//GetFileBlockChecksums calculates the block checksums of the file at path, reading it as set by "cache" in ctx
+func GetFileBlockChecksums(ctx context.Context, path string) ([]uint32, error) {
+	bc := newBlockChecksummer()
+	if err := readFile(ctx, path, checksumBlockSize, func(chunk []byte) { bc.Write(chunk) }); err != nil {
+		return nil, err
+	}
+
+	return bc.Sums(), nil
+}
+
+//encodeBlocks packs block checksums for storage
+func encodeBlocks(blocks []uint32) []byte {
+	res := make([]byte, 4*len(blocks))
+	for i, sum := range blocks {
+		binary.LittleEndian.PutUint32(res[4*i:], sum)
+	}
+
+	return res
+}
+
+//decodeBlocks unpacks block checksums packed by encodeBlocks
+func decodeBlocks(packed []byte) []uint32 {
+	if len(packed) == 0 {
+		return nil
+	}
+
+	res := make([]uint32, len(packed)/4)
+	for i := range res {
+		res[i] = binary.LittleEndian.Uint32(packed[4*i:])
+	}
+
+	return res
+}
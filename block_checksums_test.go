@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestBlockChecksummer(t *testing.T) {
+	data := bytes.Repeat([]byte{1, 2, 3}, int(checksumBlockSize))
+
+	whole := newBlockChecksummer()
+	whole.Write(data)
+
+	// the way data is split into writes must not matter
+	chunked := newBlockChecksummer()
+	for i := 0; i < len(data); i += 1000 {
+		end := i + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		chunked.Write(data[i:end])
+	}
+
+	if len(whole.Sums()) != 3 {
+		t.Error("expected 3 blocks, got", len(whole.Sums()))
+	}
+	if !reflect.DeepEqual(whole.Sums(), chunked.Sums()) {
+		t.Error("expected equal checksums", whole.Sums(), chunked.Sums())
+	}
+
+	partial := newBlockChecksummer()
+	partial.Write(data[:checksumBlockSize+1])
+	if len(partial.Sums()) != 2 {
+		t.Error("expected 2 blocks, got", len(partial.Sums()))
+	}
+}
+
+func TestGetFileBlockChecksums(t *testing.T) {
+	f, err := ioutil.TempFile("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	data := bytes.Repeat([]byte{7}, int(checksumBlockSize)+5)
+	f.Write(data)
+	f.Close()
+
+	expected := newBlockChecksummer()
+	expected.Write(data)
+
+	blocks, err := GetFileBlockChecksums(context.Background(), f.Name())
+	if err != nil || !reflect.DeepEqual(blocks, expected.Sums()) {
+		t.Error("unexpected", blocks, expected.Sums(), err)
+	}
+
+	if _, err := GetFileBlockChecksums(context.Background(), "./non-existent"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestEncodeBlocks(t *testing.T) {
+	blocks := []uint32{0, 1, 0xffffffff, 42}
+	if decoded := decodeBlocks(encodeBlocks(blocks)); !reflect.DeepEqual(blocks, decoded) {
+		t.Error("expected", blocks, "got", decoded)
+	}
+
+	if decoded := decodeBlocks(nil); decoded != nil {
+		t.Error("expected nil, got", decoded)
+	}
+}
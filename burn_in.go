@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+type (
+	//PassSummary is the outcome of one generate, verify and clean pass of a burn-in
+	PassSummary struct {
+		Pass                int       `json:"pass"`
+		Started             time.Time `json:"started"`
+		Seconds             float64   `json:"seconds"`
+		Written             int64     `json:"bytes_written"`
+		WriteBytesPerSecond int64     `json:"write_bytes_per_second"`
+		Read                int64     `json:"bytes_read"`
+		ReadBytesPerSecond  int64     `json:"read_bytes_per_second"`
+		Errors              int       `json:"errors"`
+		Verdict             string    `json:"verdict"`
+	}
+
+	//BurnInResult sums the passes of a burn-in up
+	BurnInResult struct {
+		Passes  []*PassSummary `json:"passes"`
+		Seconds float64        `json:"seconds"`
+		Written int64          `json:"bytes_written"`
+		Errors  int            `json:"errors"`
+		// passes whose verdict was not pass
+		Failed int `json:"failed_passes"`
+	}
+)
+
+func newPassSummary(pass int, report *RunReport) *PassSummary {
+	summary := &PassSummary{
+		Pass:    pass,
+		Started: report.Started,
+		Seconds: report.Seconds,
+		Errors:  report.ErrorCount(),
+		Verdict: report.Verdict,
+	}
+	if report.Write != nil {
+		summary.Written = report.Write.Total.Bytes
+		summary.WriteBytesPerSecond = report.Write.Total.BytesPerSecond
+	}
+	if report.Read != nil {
+		summary.Read = report.Read.Total.Bytes
+		summary.ReadBytesPerSecond = report.Read.Total.BytesPerSecond
+	}
+
+	return summary
+}
+
+//Print writes the pass as one line
+func (pass *PassSummary) Print(w io.Writer) {
+	fmt.Fprintf(w, "  pass %-4d %-10v %10s written %10s/s, %10s read %10s/s, %d errors, %s\n",
+		pass.Pass, secondsDuration(pass.Seconds).Round(time.Second),
+		sizeFormat.ToString(pass.Written), sizeFormat.ToString(pass.WriteBytesPerSecond),
+		sizeFormat.ToString(pass.Read), sizeFormat.ToString(pass.ReadBytesPerSecond),
+		pass.Errors, pass.Verdict)
+}
+
+func (res *BurnInResult) add(pass *PassSummary) {
+	res.Passes = append(res.Passes, pass)
+	res.Seconds += pass.Seconds
+	res.Written += pass.Written
+	res.Errors += pass.Errors
+	if pass.Verdict != verdictPass {
+		res.Failed++
+	}
+}
+
+//trend is the change of the write throughput from the first to the last pass, in percent
+func (res *BurnInResult) trend() float64 {
+	if len(res.Passes) < 2 || res.Passes[0].WriteBytesPerSecond == 0 {
+		return 0
+	}
+
+	first, last := res.Passes[0].WriteBytesPerSecond, res.Passes[len(res.Passes)-1].WriteBytesPerSecond
+	return float64(last-first) * 100 / float64(first)
+}
+
+//Print writes every pass and the totals
+func (res *BurnInResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "burn-in: %d passes in %v, %s written, %d errors, %d failed passes\n",
+		len(res.Passes), secondsDuration(res.Seconds).Round(time.Second), sizeFormat.ToString(res.Written), res.Errors, res.Failed)
+	for _, pass := range res.Passes {
+		pass.Print(w)
+	}
+
+	if len(res.Passes) > 1 {
+		first, last := res.Passes[0], res.Passes[len(res.Passes)-1]
+		fmt.Fprintf(w, "  write throughput trend: %s/s in pass %d, %s/s in pass %d (%+.1f%%)\n",
+			sizeFormat.ToString(first.WriteBytesPerSecond), first.Pass, sizeFormat.ToString(last.WriteBytesPerSecond), last.Pass, res.trend())
+	}
+}
+
+//burnIn repeats passes of generate, verify and clean at rootPath: cmdFlags.passes of them (0 unlimited), none started after cmdFlags.duration.
+//It stops early on a pass cancelled or not cleaned up, so its files are kept. returns the exit code
+func burnIn(cmdFlags *cmdFlags, flags *flag.FlagSet, rootPath string) int {
+	switch {
+	case cmdFlags.passes < 0 || cmdFlags.duration < 0:
+		fmt.Fprintln(os.Stderr, "bad -passes", cmdFlags.passes, "or -duration", cmdFlags.duration)
+		return exitBadArgs
+	case strings.Compare(cmdFlags.generate, "y") != 0 || cmdFlags.skipVerify:
+		fmt.Fprintln(os.Stderr, "a burn-in generates and verifies every pass")
+		return exitBadArgs
+	case strings.Compare(cmdFlags.resume, "y") == 0:
+		fmt.Fprintln(os.Stderr, "a burn-in can't be resumed")
+		return exitBadArgs
+	case cmdFlags.cleanup == cleanupNever:
+		fmt.Fprintln(os.Stderr, "a burn-in needs -cleanup", cleanupOnSuccess, "or", cleanupAlways, "to make room for the next pass")
+		return exitBadArgs
+	}
+
+	runReport := NewRunReport(flags, rootPath)
+	if len(cmdFlags.command) > 0 {
+		runReport.Parameters["command"] = cmdFlags.command
+	}
+	result := &BurnInResult{}
+	// the verification of the first pass that failed
+	var failed *VerifyResult
+
+	for pass := 1; cmdFlags.passes == 0 || pass <= cmdFlags.passes; pass++ {
+		if cmdFlags.duration > 0 && time.Since(runReport.Started) >= cmdFlags.duration {
+			fmt.Println("the burn-in duration of", cmdFlags.duration, "is over")
+			break
+		}
+		if cmdFlags.passes > 0 {
+			fmt.Println("burn-in pass", pass, "of", cmdFlags.passes)
+		} else {
+			fmt.Println("burn-in pass", pass)
+		}
+
+		// a pass adjusts its flags, e.g. to the manifest it generates
+		passFlags := *cmdFlags
+		passFlags.report = ""
+		passFlags.waitBeforeExit = "n"
+		passReport, exitCode := runPass(&passFlags, flags, rootPath)
+		if passReport == nil {
+			return exitCode
+		}
+
+		summary := newPassSummary(pass, passReport)
+		result.add(summary)
+		runReport.merge(passReport)
+		if failed == nil && passReport.Verify != nil && !passReport.Verify.Success() {
+			failed = passReport.Verify
+		}
+		fmt.Println("burn-in so far:")
+		result.Print(os.Stdout)
+
+		if passReport.Verdict == verdictCancelled {
+			break
+		}
+		if passReport.Clean == nil {
+			fmt.Println("stopping the burn-in: the files of pass", pass, "were kept")
+			break
+		}
+	}
+
+	runReport.BurnIn = result
+	runReport.Finish(nil, nil, failed, nil, nil)
+	writeReport(runReport, cmdFlags.report)
+	done(cmdFlags)
+
+	return runReport.ExitCode()
+}
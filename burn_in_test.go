@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+func TestBurnInResult(t *testing.T) {
+	result := &BurnInResult{}
+	result.add(&PassSummary{Pass: 1, Seconds: 10, Written: sizeFormat.GB, WriteBytesPerSecond: 200, Verdict: verdictPass})
+	result.add(&PassSummary{Pass: 2, Seconds: 12, Written: sizeFormat.GB, WriteBytesPerSecond: 150, Errors: 2, Verdict: verdictError})
+
+	if result.Written != 2*sizeFormat.GB || result.Errors != 2 || result.Failed != 1 || result.Seconds != 22 {
+		t.Error("unexpected totals", *result)
+	}
+	if trend := result.trend(); trend != -25 {
+		t.Error("expected -25% trend, got", trend)
+	}
+
+	var out bytes.Buffer
+	result.Print(&out)
+	if !strings.Contains(out.String(), "2 passes") || !strings.Contains(out.String(), "-25.0%") {
+		t.Error("unexpected output", out.String())
+	}
+}
+
+func TestNewPassSummary(t *testing.T) {
+	stats := NewIOStats("write", nil)
+	stats.Record(sizeFormat.MB, 0)
+	report := NewRunReport(flag.NewFlagSet("test", flag.ContinueOnError), "/data")
+	report.Finish(stats, nil, NewVerifyResult(), nil, nil)
+
+	pass := newPassSummary(3, report)
+	if pass.Pass != 3 || pass.Written != sizeFormat.MB || pass.Read != 0 || pass.Verdict != verdictPass {
+		t.Error("unexpected pass", *pass)
+	}
+}
+
+func TestBurnIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "burnin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "volume")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "report.json")
+
+	if code := runCommand([]string{"generate", "-size=1MB", "-sizes=fixed=256KB", "-maxparallel=1", "-passes=2", "-report=" + report, root}); code != exitSuccess {
+		t.Fatal("expected exit code", exitSuccess, "got", code)
+	}
+	if left, _ := ioutil.ReadDir(root); len(left) != 0 {
+		t.Error("expected every pass to be cleaned up, got", len(left))
+	}
+
+	loaded, err := LoadRunReport(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.BurnIn == nil || len(loaded.BurnIn.Passes) != 2 || loaded.BurnIn.Written != 2*sizeFormat.MB || loaded.Verdict != verdictPass {
+		t.Error("unexpected burn-in report", loaded.BurnIn, loaded.Verdict)
+	}
+
+	for _, args := range [][]string{
+		{"generate", "-passes=2", "-cleanup=never", root},
+		{"generate", "-passes=-1", root},
+		{"generate", "-duration=1h", "-verify=false", root},
+	} {
+		if code := runCommand(args); code != exitBadArgs {
+			t.Error(args, "expected exit code", exitBadArgs, "got", code)
+		}
+	}
+}
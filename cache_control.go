@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+//how file I/O treats the OS page cache, set by "cache" in ctx
+const (
+	cacheUse = "use"
+	// fsync written files and drop them from the page cache, drop files from it before reading
+	cacheDrop = "drop"
+	// open files with O_DIRECT, so reads and writes go to the device
+	cacheBypass = "bypass"
+)
+
+//O_DIRECT buffers, offsets and transfer sizes have to be multiples of the logical block size
+const directAlignment = 4096
+
+var (
+	errDirectIOUnsupported = errors.New("direct I/O is not supported on this platform")
+	directFallbackWarning  sync.Once
+)
+
+//openForWrite creates the file at path as set by "cache" in ctx. Tells if it was opened for direct I/O
+func openForWrite(ctx context.Context, path string) (*os.File, bool, error) {
+	if GetStringOrDefault(ctx, "cache", cacheUse) == cacheBypass {
+		f, err := openDirect(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if !isDirectUnsupported(err) {
+			return f, err == nil, err
+		}
+		warnDirectFallback(err)
+	}
+
+	f, err := os.Create(path)
+	return f, false, err
+}
+
+//closeWritten closes a file opened with openForWrite, making sure the data left the page cache unless "cache" in ctx is use
+func closeWritten(ctx context.Context, f *os.File) error {
+	if GetStringOrDefault(ctx, "cache", cacheUse) != cacheUse {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		dropCache(f)
+	}
+
+	return f.Close()
+}
+
+//openForRead opens the file at path as set by "cache" in ctx. Tells if it was opened for direct I/O
+func openForRead(ctx context.Context, path string) (*os.File, bool, error) {
+	mode := GetStringOrDefault(ctx, "cache", cacheUse)
+	if mode == cacheBypass {
+		f, err := openDirect(path, os.O_RDONLY, 0)
+		if !isDirectUnsupported(err) {
+			return f, err == nil, err
+		}
+		warnDirectFallback(err)
+	}
+
+	f, err := os.Open(path)
+	if err == nil && mode != cacheUse {
+		// whatever is cached was not necessarily read from the device
+		dropCache(f)
+	}
+
+	return f, false, err
+}
+
+//readFile reads the file at path in chunks of up to bufSize bytes, as set by "cache" in ctx
+func readFile(ctx context.Context, path string, bufSize int, consume func(chunk []byte)) error {
+	f, direct, err := openForRead(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var buf []byte
+	if direct {
+		buf = alignedBuffer(bufSize)
+	} else {
+		buf = make([]byte, bufSize)
+	}
+
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			consume(buf[:n])
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//alignedBuffer returns a buffer of size rounded up to directAlignment, starting at an aligned address
+func alignedBuffer(size int) []byte {
+	size = int(alignUp(int64(size)))
+	buf := make([]byte, size+directAlignment)
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (directAlignment - 1)); rem != 0 {
+		offset = directAlignment - rem
+	}
+
+	return buf[offset : offset+size]
+}
+
+func alignUp(size int64) int64 {
+	return (size + directAlignment - 1) &^ (directAlignment - 1)
+}
+
+//isDirectUnsupported tells if opening with O_DIRECT failed because the platform or the filesystem (e.g. tmpfs) does not support it
+func isDirectUnsupported(err error) bool {
+	return err == errDirectIOUnsupported || errors.Is(err, syscall.EINVAL)
+}
+
+func warnDirectFallback(err error) {
+	directFallbackWarning.Do(func() {
+		fmt.Fprintln(os.Stderr, "WARN: direct I/O is not available, syncing and dropping files from the page cache instead:", err)
+	})
+}
@@ -0,0 +1,22 @@
+//go:build linux && !386 && !arm && !mips && !mipsle
+// +build linux,!386,!arm,!mips,!mipsle
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const fadviseDontNeed = 4
+
+//dropCache asks the kernel to evict the pages of f from the page cache. Dirty pages are not evicted: sync first
+func dropCache(f *os.File) error {
+	// posix_fadvise(fd, 0, 0, POSIX_FADV_DONTNEED): the whole file
+	_, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, fadviseDontNeed, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+//the page cache can be bypassed on this platform
+const cacheControlSupported = true
+
+func openDirect(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag|syscall.O_DIRECT, perm)
+}
@@ -0,0 +1,14 @@
+//go:build linux && (386 || arm || mips || mipsle)
+// +build linux
+// +build 386 arm mips mipsle
+
+package main
+
+import (
+	"os"
+)
+
+//dropCache is not implemented on 32 bit platforms, where the fadvise64 arguments are laid out differently
+func dropCache(f *os.File) error {
+	return errDirectIOUnsupported
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"os"
+)
+
+//the page cache can be bypassed or dropped on this platform
+const cacheControlSupported = false
+
+func openDirect(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return nil, errDirectIOUnsupported
+}
+
+func dropCache(f *os.File) error {
+	return errDirectIOUnsupported
+}
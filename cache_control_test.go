@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestAlignedBuffer(t *testing.T) {
+	for _, size := range []int{1, directAlignment, 3*directAlignment + 5} {
+		buf := alignedBuffer(size)
+		if uintptr(unsafe.Pointer(&buf[0]))%directAlignment != 0 {
+			t.Error("buffer of", size, "is not aligned")
+		}
+		if len(buf) < size || len(buf)%directAlignment != 0 {
+			t.Error("unexpected buffer length", len(buf), "for", size)
+		}
+	}
+}
+
+func TestGenerateAndReadCacheModes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, mode := range []string{cacheUse, cacheDrop, cacheBypass} {
+		if mode != cacheUse && !cacheControlSupported {
+			continue
+		}
+		ctx := context.WithValue(context.Background(), "cache", mode)
+		path := filepath.Join(dir, mode)
+
+		// not a multiple of the direct I/O alignment
+		size := int64(2*checksumBlockSize + 1234)
+		hash, blocks, err := GenerateSeeded(ctx, size, path, NewSeededContent(42, mode))
+		if err != nil {
+			t.Fatal(mode, err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.Size() != size {
+			t.Error(mode, "unexpected file size", info, err)
+		}
+
+		if readHash, err := GetFileMd5(ctx, path); err != nil || readHash != hash {
+			t.Error(mode, "unexpected hash", readHash, hash, err)
+		}
+
+		if mismatch, _, err := CompareSeeded(ctx, path, NewSeededContent(42, mode)); err != nil || mismatch != -1 {
+			t.Error(mode, "unexpected mismatch", mismatch, err)
+		}
+
+		readBlocks, err := GetFileBlockChecksums(ctx, path)
+		if err != nil || len(readBlocks) != len(blocks) || readBlocks[2] != blocks[2] {
+			t.Error(mode, "unexpected block checksums", readBlocks, blocks, err)
+		}
+	}
+}
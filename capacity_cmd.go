@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+//space left on the volume while filling it, so the filesystem metadata has room to grow
+const capacityReserve = 16 * sizeFormat.MB
+
+type (
+	//CapacityResult holds the outcome of CapacityCmd
+	CapacityResult struct {
+		// size of the filesystem as reported by the OS
+		Total int64 `json:"total"`
+		// bytes the filesystem accepted
+		Claimed int64 `json:"claimed"`
+		// bytes that read back as written, wherever they are
+		Actual int64 `json:"actual"`
+		// bytes that did not read back as written, e.g. overwritten when a fake drive wraps around
+		Lost int64 `json:"lost"`
+	}
+
+	//capacityRecorder keeps the generated files in the order they were written
+	capacityRecorder struct {
+		*InMemRecorder
+		files []*TempFile
+	}
+)
+
+//Mismatch tells if the volume holds less than it claims
+func (res *CapacityResult) Mismatch() bool {
+	return res.Actual < res.Claimed
+}
+
+//Print writes the claimed and the actual capacity
+func (res *CapacityResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "claimed %s, actual %s, lost %s\n", sizeFormat.ToString(res.Claimed), sizeFormat.ToString(res.Actual), sizeFormat.ToString(res.Lost))
+}
+
+//RecordFile implements IFileRecorder
+func (rec *capacityRecorder) RecordFile(file *TempFile) error {
+	if file == nil {
+		return errors.New("temp file can't be null")
+	}
+
+	rec.files = append(rec.files, file)
+	return rec.InMemRecorder.RecordFile(file)
+}
+
+//CapacityCmd fills the free space at rootPath, then reads it back in the order it was written
+//to find the real usable capacity of a (possibly counterfeit) drive. The result is populated once the returned WaitGroup is done
+func CapacityCmd(ctx context.Context, rootPath string, errorChan chan<- error) (*sync.WaitGroup, *CapacityResult, error) {
+	total, free, err := diskSpace(rootPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if free <= capacityReserve {
+		return nil, nil, fmt.Errorf("not enough free space at %s: %s", rootPath, sizeFormat.ToString(free))
+	}
+
+	size := free - capacityReserve
+	fmt.Println("filesystem size", sizeFormat.ToString(total), "filling", sizeFormat.ToString(size), "of free space")
+
+	ctx = capacityContext(ctx)
+
+	result := &CapacityResult{Total: total}
+	rec := &capacityRecorder{InMemRecorder: NewInMemRecorder()}
+	recorder := IFileRecorder(rec)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		// running out of space is expected here: stop filling instead of failing
+		genCtx, stopGeneration := context.WithCancel(ctx)
+		genErrors := make(chan error)
+		generateDone := GenerateCmd(genCtx, rootPath, size, &recorder, genErrors, nil)
+		go func() {
+			generateDone.Wait()
+			close(genErrors)
+		}()
+		for err := range genErrors {
+			fmt.Fprintln(os.Stderr, "WARN: stopping the fill:", err)
+			stopGeneration()
+		}
+		stopGeneration()
+
+		if ctx.Err() != nil {
+			errorChan <- ctx.Err()
+			return
+		}
+
+		measureCapacity(ctx, rec.files, result)
+
+		result.Print(os.Stdout)
+		if result.Mismatch() {
+			fmt.Fprintln(os.Stderr, "ERR:", sizeFormat.ToString(result.Lost),
+				"of the filled space did not read back as written. The drive holds less than it claims")
+		} else {
+			fmt.Println("Success: all of the claimed capacity was read back")
+		}
+	}()
+
+	return &wg, result, nil
+}
+
+//capacityContext sets ctx up for filling the volume and reading it back
+func capacityContext(ctx context.Context) context.Context {
+	// a single writer, so the files are laid out on the volume in the order they are recorded
+	ctx = context.WithValue(ctx, "max_parallel", 1)
+
+	// the data has to come back from the drive: what the page cache still holds says nothing about it
+	if GetStringOrDefault(ctx, "cache", cacheUse) == cacheUse {
+		if cacheControlSupported {
+			return context.WithValue(ctx, "cache", cacheDrop)
+		}
+		fmt.Fprintln(os.Stderr, "WARN: the page cache can't be dropped on this platform, the files still cached read back as written")
+	}
+
+	return ctx
+}
+
+//measureCapacity reads files back in order and sums the blocks that read back as written up.
+//a drive wrapping around overwrites the data written first, so the corrupted blocks may be anywhere
+func measureCapacity(ctx context.Context, files []*TempFile, result *CapacityResult) {
+	report := &CorruptionReport{blockHits: make(map[int64]int)}
+	for _, file := range files {
+		result.Claimed += file.size
+		fmt.Println("verifying", file.path, sizeFormat.ToString(file.size))
+
+		fc := analyzeCorruption(ctx, file)
+		lost := fc.corrupted
+		if fc.missing {
+			lost = file.size
+		}
+		result.Actual += file.size - lost
+		result.Lost += lost
+
+		if lost > 0 {
+			report.add(fc)
+		}
+	}
+
+	report.Print(os.Stderr)
+}
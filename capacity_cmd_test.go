@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCapacityRecorder(t *testing.T) {
+	rec := &capacityRecorder{InMemRecorder: NewInMemRecorder()}
+
+	rec.RecordFile(&TempFile{path: "a", hash: "hash1"})
+	rec.RecordFile(&TempFile{path: "c", hash: "hash3"})
+
+	if len(rec.files) != 2 || rec.files[0].path != "a" || rec.files[1].path != "c" {
+		t.Error("expected written files in order, got", rec.files)
+	}
+
+	if err := rec.RecordFile(nil); err == nil {
+		t.Error("expected error on nil file")
+	}
+}
+
+func TestMeasureCapacity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	size := 2 * checksumBlockSize
+	data := bytes.Repeat([]byte{1}, int(size))
+	bc := newBlockChecksummer()
+	bc.Write(data)
+
+	files := make([]*TempFile, 3)
+	for i := range files {
+		files[i] = &TempFile{path: filepath.Join(dir, string('a'+rune(i))), size: int64(size), blocks: bc.Sums()}
+		ioutil.WriteFile(files[i].path, data, 0644)
+	}
+
+	result := &CapacityResult{}
+	measureCapacity(context.Background(), files, result)
+	if result.Mismatch() || result.Claimed != 3*int64(size) {
+		t.Error("expected no mismatch, got", result)
+	}
+
+	// the drive wraps around in the middle of the 2nd file
+	data[checksumBlockSize] = 0
+	ioutil.WriteFile(files[1].path, data, 0644)
+	ioutil.WriteFile(files[2].path, data, 0644)
+
+	result = &CapacityResult{}
+	measureCapacity(context.Background(), files, result)
+	if !result.Mismatch() || result.Actual != 3*int64(size)-2*checksumBlockSize || result.Lost != 2*checksumBlockSize {
+		t.Error("expected actual capacity of", 3*int64(size)-2*checksumBlockSize, "got", result)
+	}
+
+	// the data written first was overwritten by the last one
+	os.Remove(files[2].path)
+	ioutil.WriteFile(files[0].path, bytes.Repeat([]byte{2}, int(size)), 0644)
+	ioutil.WriteFile(files[1].path, bytes.Repeat([]byte{1}, int(size)), 0644)
+
+	result = &CapacityResult{}
+	measureCapacity(context.Background(), files, result)
+	if result.Actual != int64(size) || result.Lost != 2*int64(size) {
+		t.Error("expected the 2nd file to count, got", result)
+	}
+}
+
+func TestCapacityCmd(t *testing.T) {
+	if _, _, err := CapacityCmd(context.Background(), "/non-existent", nil); err == nil {
+		t.Error("expected error on missing path")
+	}
+}
+
+func TestCapacityContext(t *testing.T) {
+	ctx := capacityContext(context.WithValue(context.Background(), "max_parallel", 4))
+	if GetIntOrDefault(ctx, "max_parallel", 0) != 1 {
+		t.Error("expected a single writer")
+	}
+	if cacheControlSupported && GetStringOrDefault(ctx, "cache", cacheUse) != cacheDrop {
+		t.Error("expected the page cache to be dropped")
+	}
+
+	ctx = capacityContext(context.WithValue(context.Background(), "cache", cacheBypass))
+	if GetStringOrDefault(ctx, "cache", cacheUse) != cacheBypass {
+		t.Error("expected -cache=bypass to be kept")
+	}
+}
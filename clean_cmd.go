@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+//-cleanup values: when the generated files are removed once verified
+const (
+	cleanupAlways    = "always"
+	cleanupOnSuccess = "onsuccess"
+	// keep the files, e.g. for forensics
+	cleanupNever = "never"
+)
+
+type (
+	//CleanResult holds the outcome of CleanCmd
+	CleanResult struct {
+		Files int64 `json:"files"`
+		// bytes freed
+		Bytes int64 `json:"bytes"`
+		Dirs  int64 `json:"dirs"`
+		// recorded in the manifest or the recorder, but not found
+		Missing int64 `json:"missing"`
+		// left alone: not generated, not a regular file or outside of the volume root
+		Skipped int64 `json:"skipped"`
+	}
+
+	//cleaner removes the files it is given and keeps track of their folders
+	cleaner struct {
+		root   string
+		result *CleanResult
+		dirs   map[string]bool
+		lock   sync.Mutex
+	}
+)
+
+//Print writes what was removed and freed
+func (res *CleanResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "clean: %d files and %d folders removed, %s freed\n", res.Files, res.Dirs, sizeFormat.ToString(res.Bytes))
+	if res.Missing > 0 {
+		fmt.Fprintf(w, "  %d recorded files were not found\n", res.Missing)
+	}
+	if res.Skipped > 0 {
+		fmt.Fprintf(w, "  %d entries not generated by disktest were left\n", res.Skipped)
+	}
+}
+
+//shouldCleanUp tells if the files are removed after a run with verdict, as the -cleanup policy says.
+//cancelled runs are never cleaned up
+func shouldCleanUp(policy string, verdict string) bool {
+	switch {
+	case verdict == verdictCancelled:
+		return false
+	case policy == cleanupAlways:
+		return true
+	case policy == cleanupOnSuccess:
+		return verdict == verdictPass
+	}
+
+	return false
+}
+
+//CleanCmd removes the files generated at rootPath: the ones listed in the manifest at manifestPath, the ones recorded by
+//recorder or, without either, the ones named the way they are generated, in the generated subfolders. The folders emptied
+//are removed as well, the volume root and anything else is left. The result is populated once the returned WaitGroup is done
+func CleanCmd(ctx context.Context, rootPath string, manifestPath string, recorder IFileRecorder, errorChan chan<- error) (*sync.WaitGroup, *CleanResult, error) {
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil, fmt.Errorf("%s is not a directory", rootPath)
+	}
+	if len(manifestPath) > 0 {
+		if _, err := os.Stat(manifestPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	result := &CleanResult{}
+	clean := &cleaner{root: filepath.Clean(rootPath), result: result, dirs: make(map[string]bool)}
+	workers := GetIntOrDefault(ctx, "max_parallel", 1)
+
+	var paths <-chan string
+	if len(manifestPath) > 0 {
+		fmt.Println("removing the files of the manifest", manifestPath, "from", rootPath)
+		paths = manifestPaths(ctx, manifestPath, clean.root, errorChan)
+	} else if recorder != nil {
+		fmt.Println("removing the recorded files from", rootPath)
+		paths = recordedPaths(ctx, recorder, errorChan)
+	} else {
+		fmt.Println("removing the generated files from", rootPath)
+		paths = clean.generatedPaths(ctx, errorChan)
+	}
+
+	var workersDone sync.WaitGroup
+	workersDone.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer workersDone.Done()
+			// the paths stop coming once ctx is done
+			for path := range paths {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := clean.remove(path); err != nil {
+					errorChan <- newFileError(errCategoryWrite, path, err)
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		workersDone.Wait()
+
+		clean.removeDirs()
+		result.Print(os.Stdout)
+	}()
+
+	return &wg, result, nil
+}
+
+//manifestPaths sends the paths of the files of the manifest
+func manifestPaths(ctx context.Context, manifestPath string, rootPath string, errorChan chan<- error) <-chan string {
+	paths := make(chan string)
+
+	go func() {
+		defer close(paths)
+		_, err := scanManifest(manifestPath, rootPath, func(file *TempFile) error {
+			select {
+			case paths <- file.path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			errorChan <- newFileError(errCategoryRecord, manifestPath, err)
+		}
+	}()
+
+	return paths
+}
+
+//recordedPaths sends the paths of all the files recorded by recorder, verified or not
+func recordedPaths(ctx context.Context, recorder IFileRecorder, errorChan chan<- error) <-chan string {
+	paths := make(chan string)
+
+	go func() {
+		defer close(paths)
+		if unmarker, ok := recorder.(interface{ UnmarkAll() error }); ok {
+			if err := unmarker.UnmarkAll(); err != nil {
+				errorChan <- newFileError(errCategoryRecord, "", err)
+				return
+			}
+		}
+		files, err := recorder.FilesNotCheckedYet()
+		if err != nil {
+			errorChan <- newFileError(errCategoryRecord, "", err)
+			return
+		}
+
+		for _, file := range files {
+			select {
+			case paths <- file.path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return paths
+}
+
+//generatedPaths sends the paths of the generated files below the root. only the generated subfolders are descended into,
+//and are removed once empty even if no file was removed from them
+func (clean *cleaner) generatedPaths(ctx context.Context, errorChan chan<- error) <-chan string {
+	paths := make(chan string)
+	rootPath, result := clean.root, clean.result
+
+	go func() {
+		defer close(paths)
+		filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				errorChan <- newFileError(errCategoryWalk, path, err)
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			switch {
+			case path == rootPath:
+				return nil
+			case info.IsDir() && isGeneratedName(folderPrefix, info.Name()):
+				clean.addDir(path)
+				return nil
+			case info.IsDir():
+				atomic.AddInt64(&result.Skipped, 1)
+				return filepath.SkipDir
+			case !info.Mode().IsRegular() || !isGeneratedFile(info.Name()):
+				atomic.AddInt64(&result.Skipped, 1)
+				return nil
+			}
+
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	return paths
+}
+
+//remove removes the regular file at path below the root
+func (clean *cleaner) remove(path string) error {
+	rel, err := filepath.Rel(clean.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		fmt.Fprintln(os.Stderr, "WARN: not removing", path, "outside of", clean.root)
+		atomic.AddInt64(&clean.result.Skipped, 1)
+		return nil
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		atomic.AddInt64(&clean.result.Missing, 1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		fmt.Fprintln(os.Stderr, "WARN: not removing", path, "which is not a regular file")
+		atomic.AddInt64(&clean.result.Skipped, 1)
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&clean.result.Files, 1)
+	atomic.AddInt64(&clean.result.Bytes, info.Size())
+
+	clean.addDir(filepath.Dir(path))
+
+	return nil
+}
+
+//addDir adds dir and its parents up to the root to the folders to remove
+func (clean *cleaner) addDir(dir string) {
+	clean.lock.Lock()
+	defer clean.lock.Unlock()
+
+	for ; dir != clean.root && !clean.dirs[dir]; dir = filepath.Dir(dir) {
+		clean.dirs[dir] = true
+	}
+}
+
+//removeDirs removes the generated folders files were removed from, deepest first. folders still holding anything are left
+func (clean *cleaner) removeDirs() {
+	dirs := make([]string, 0, len(clean.dirs))
+	for dir := range clean.dirs {
+		if isGeneratedName(folderPrefix, filepath.Base(dir)) {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return len(dirs[i]) > len(dirs[j])
+	})
+
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err == nil {
+			clean.result.Dirs++
+		}
+	}
+}
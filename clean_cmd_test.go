@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, root string, paths ...string) {
+	for _, path := range paths {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func runClean(t *testing.T, root string, manifest string, recorder IFileRecorder) *CleanResult {
+	errCh := make(chan error)
+	go func() {
+		for err := range errCh {
+			t.Error(err)
+		}
+	}()
+
+	ctx := context.WithValue(context.Background(), "max_parallel", 2)
+	wg, result, err := CleanCmd(ctx, root, manifest, recorder, errCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	return result
+}
+
+func TestCleanCmdNamingScheme(t *testing.T) {
+	root, err := ioutil.TempDir("", "clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root,
+		"file_0.tmp", "file_1_abc.tmp", ".file_2.tmp.partial",
+		filepath.Join("subfolder_0.tmp", "file_0.tmp"),
+		filepath.Join("subfolder_0.tmp", "subfolder_1.tmp", "file_0.tmp"),
+		// not generated
+		"notes.txt", "file_x.tmp",
+		filepath.Join("photos", "file_0.tmp"),
+		filepath.Join("subfolder_1.tmp", "mine", "file_0.tmp"),
+	)
+	if err := os.Mkdir(filepath.Join(root, "subfolder_2.tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runClean(t, root, "", nil)
+	if result.Files != 5 || result.Bytes != 50 || result.Dirs != 3 {
+		t.Error("unexpected result", *result)
+	}
+
+	for _, kept := range []string{"notes.txt", "file_x.tmp", filepath.Join("photos", "file_0.tmp"), filepath.Join("subfolder_1.tmp", "mine", "file_0.tmp")} {
+		if _, err := os.Stat(filepath.Join(root, kept)); err != nil {
+			t.Error("expected", kept, "to be kept", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "subfolder_0.tmp")); !os.IsNotExist(err) {
+		t.Error("expected emptied folder to be removed", err)
+	}
+}
+
+func TestCleanCmdManifest(t *testing.T) {
+	root, err := ioutil.TempDir("", "clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	volume := filepath.Join(root, "volume")
+	writeTestFiles(t, volume, "file_0.tmp", filepath.Join("subfolder_0.tmp", "file_0.tmp"), "file_1.tmp")
+	writeTestFiles(t, root, "outside.tmp")
+
+	manifest := filepath.Join(root, "manifest.jsonl")
+	rec, err := NewManifestRecorder(manifest, volume, nil, &manifestHeader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"file_0.tmp", filepath.Join("subfolder_0.tmp", "file_0.tmp"), "missing.tmp", filepath.Join("..", "outside.tmp")} {
+		if err := rec.RecordFile(&TempFile{path: filepath.Join(volume, path), size: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec.Close()
+
+	result := runClean(t, volume, manifest, nil)
+	if result.Files != 2 || result.Bytes != 20 || result.Dirs != 1 || result.Missing != 1 || result.Skipped != 1 {
+		t.Error("unexpected result", *result)
+	}
+
+	for _, kept := range []string{filepath.Join("volume", "file_1.tmp"), "outside.tmp"} {
+		if _, err := os.Stat(filepath.Join(root, kept)); err != nil {
+			t.Error("expected", kept, "to be kept", err)
+		}
+	}
+
+	if _, _, err := CleanCmd(context.Background(), filepath.Join(root, "nonexistent"), "", nil, nil); err == nil {
+		t.Error("expected error for missing root")
+	}
+}
+
+func TestCleanCmdRecorder(t *testing.T) {
+	root, err := ioutil.TempDir("", "clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeTestFiles(t, root, "file_0.tmp", filepath.Join("subfolder_0.tmp", "file_0.tmp"), "file_1.tmp")
+
+	rec := NewInMemRecorder()
+	for _, path := range []string{"file_0.tmp", filepath.Join("subfolder_0.tmp", "file_0.tmp")} {
+		file := &TempFile{path: filepath.Join(root, path), size: 10, hash: "hash"}
+		rec.RecordFile(file)
+	}
+	// verified files are removed as well
+	rec.MarkPathExists(filepath.Join(root, "file_0.tmp"))
+
+	result := runClean(t, root, "", rec)
+	if result.Files != 2 || result.Bytes != 20 || result.Dirs != 1 {
+		t.Error("unexpected result", *result)
+	}
+	// named like a generated one, but not recorded
+	if _, err := os.Stat(filepath.Join(root, "file_1.tmp")); err != nil {
+		t.Error("expected file_1.tmp to be kept", err)
+	}
+}
+
+func TestShouldCleanUp(t *testing.T) {
+	for _, c := range []struct {
+		policy, verdict string
+		expected        bool
+	}{
+		{cleanupAlways, verdictPass, true},
+		{cleanupAlways, verdictFail, true},
+		{cleanupAlways, verdictCancelled, false},
+		{cleanupOnSuccess, verdictPass, true},
+		{cleanupOnSuccess, verdictFail, false},
+		{cleanupOnSuccess, verdictError, false},
+		{cleanupNever, verdictPass, false},
+	} {
+		if shouldCleanUp(c.policy, c.verdict) != c.expected {
+			t.Error(c.policy, c.verdict, "expected", c.expected)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+//-recorder values besides mem/sqlite/seed
+const recordNone = "none"
+
+type (
+	//command is a disktest subcommand: disktest <name> [opts] [args]
+	command struct {
+		name        string
+		args        string
+		description string
+		// the flags of the command and what to do once they are parsed
+		flags func(fs *flag.FlagSet, f *cmdFlags) func() int
+	}
+
+	//yesNoFlag is a boolean flag of the subcommands stored as the y/n of cmdFlags the flags only command line uses
+	yesNoFlag struct {
+		value *string
+	}
+)
+
+func (yn yesNoFlag) String() string {
+	if yn.value == nil || *yn.value != "y" {
+		return "false"
+	}
+
+	return "true"
+}
+
+func (yn yesNoFlag) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+
+	*yn.value = "n"
+	if b {
+		*yn.value = "y"
+	}
+	return nil
+}
+
+func (yn yesNoFlag) IsBoolFlag() bool {
+	return true
+}
+
+var commands = []*command{
+	{name: "generate", args: "path", description: "generate files at path, record them and verify them right after", flags: generateFlags},
+	{name: "verify", args: "path", description: "verify the files generated at path earlier, against a manifest, the sqlite recorder or the content seed", flags: verifyFlags},
+	{name: "clean", args: "path", description: "remove the files generated at path: the ones in the -manifest or the sqlite recorder, or with -byname all named the way disktest names them", flags: cleanFlags},
+	{name: "capacity", args: "path", description: "fill the free space at path and read it back to detect fake capacity", flags: capacityFlags},
+	{name: "metadata", args: "path", description: "create, stat and delete tiny files at path and measure the rate of each", flags: metadataFlags},
+	{name: "report", args: "report.json", description: "print a report written with -report, exits with the code of the run", flags: reportFlags},
+	{name: "bench", description: "measure how fast content is generated and hashed, without the disk", flags: benchFlags},
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: disktest <command> [opts] [args]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr, "run disktest <command> -h for the options of a command")
+}
+
+//runCommand runs the command named by the first of args, or the flags only command line. returns the exit code
+func runCommand(args []string) int {
+	if len(args) == 0 || args[0] == "help" && len(args) == 1 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		printUsage()
+		if len(args) == 0 {
+			return exitBadArgs
+		}
+		return exitSuccess
+	}
+
+	if args[0] == "help" {
+		args = []string{args[1], "-h"}
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		// disktest path is the flags only command line with the defaults
+		if _, err := os.Stat(args[0]); os.IsNotExist(err) && len(args) == 1 {
+			fmt.Fprintln(os.Stderr, "unknown command", args[0])
+			printUsage()
+			return exitBadArgs
+		}
+
+		return runFlagsOnly(args)
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	f := defaultFlags()
+	f.command = cmd.name
+	run := cmd.flags(fs, f)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: disktest %s [opts] %s\n%s\n", cmd.name, cmd.args, cmd.description)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitSuccess
+		}
+		return exitBadArgs
+	}
+
+	if len(cmd.args) > 0 && fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, cmd.args, "not provided")
+		fs.Usage()
+		return exitBadArgs
+	}
+	if len(cmd.args) == 0 && fs.NArg() != 0 {
+		fs.Usage()
+		return exitBadArgs
+	}
+
+	return run()
+}
+
+func generateFlags(fs *flag.FlagSet, f *cmdFlags) func() int {
+	addRunFlags(fs, f, false)
+	addContentFlags(fs, f, false)
+	addSyncFlags(fs, f, false)
+	addTreeFlags(fs, f)
+	addRecorderFlags(fs, f)
+	addVerifyFlags(fs, f, false)
+	fs.StringVar(&f.verify, "recorder", f.verify, fmt.Sprintf("where to record the generated files to verify them: %s (in RAM), %s or %s", verifyInMem, verifyInSQLite, recordNone))
+	verify := fs.Bool("verify", true, "verify the files right after generating them. without a recorder needs -seed and -manifest")
+	fs.IntVar(&f.passes, "passes", f.passes, "burn-in: repeat generate, verify and clean this many times. 0 = until -duration is over")
+	fs.DurationVar(&f.duration, "duration", f.duration, "burn-in: start no new pass after this long, e.g. 72h. alone, passes are repeated until then")
+
+	return func() int {
+		// a burn-in must make room for the next pass, and -duration alone is about time, not passes
+		if f.passes != 1 || f.duration != 0 {
+			if !isFlagSet(fs, "cleanup") {
+				f.cleanup = cleanupOnSuccess
+			}
+			if !isFlagSet(fs, "passes") {
+				f.passes = 0
+			}
+		}
+
+		switch {
+		case f.verify != verifyInMem && f.verify != verifyInSQLite && f.verify != recordNone:
+			fmt.Fprintln(os.Stderr, "unknown -recorder", f.verify)
+			return exitBadArgs
+		case !*verify:
+			f.skipVerify = true
+		case f.verify == recordNone && f.seed == 0:
+			fmt.Fprintln(os.Stderr, "nothing to verify against: use a -recorder or -seed, or -verify=false")
+			return exitBadArgs
+		case f.verify == recordNone && len(f.manifest) == 0:
+			fmt.Fprintln(os.Stderr, "the missing files can't be told from the seed alone: use a -manifest or a -recorder, or -verify=false")
+			return exitBadArgs
+		case f.verify == recordNone:
+			f.verify = verifySeeded
+		}
+		f.generate = "y"
+
+		return run(f, fs, fs.Arg(0))
+	}
+}
+
+func verifyFlags(fs *flag.FlagSet, f *cmdFlags) func() int {
+	addRunFlags(fs, f, false)
+	addRecorderFlags(fs, f)
+	addVerifyFlags(fs, f, false)
+	fs.StringVar(&f.verify, "recorder", "", fmt.Sprintf("what to verify against: %s (the -manifest), %s (-db) or %s (-seed). default = the one given", verifyInMem, verifyInSQLite, verifySeeded))
+	fs.Int64Var(&f.seed, "seed", f.seed, "the content seed the files were generated with")
+	fs.StringVar(&f.hash, "hash", f.hash, fmt.Sprintf("hash algorithm of the files recorded with %s: %s. a manifest names its own", verifyInSQLite, strings.Join(hashNames(), "/")))
+
+	return func() int {
+		switch {
+		case f.verify == "" && len(f.manifest) > 0:
+			f.verify = verifyInMem
+		case f.verify == "" && f.seed != 0:
+			f.verify = verifySeeded
+		case f.verify == "":
+			fmt.Fprintln(os.Stderr, "nothing to verify against: use -manifest, -recorder=sqlite or -seed")
+			return exitBadArgs
+		case f.verify == verifyInMem && len(f.manifest) == 0:
+			fmt.Fprintln(os.Stderr, "-recorder", verifyInMem, "needs the -manifest of the generation")
+			return exitBadArgs
+		case f.verify != verifyInMem && f.verify != verifyInSQLite && f.verify != verifySeeded:
+			fmt.Fprintln(os.Stderr, "unknown -recorder", f.verify)
+			return exitBadArgs
+		}
+		f.generate = "n"
+
+		return run(f, fs, fs.Arg(0))
+	}
+}
+
+func cleanFlags(fs *flag.FlagSet, f *cmdFlags) func() int {
+	addRunFlags(fs, f, false)
+	fs.StringVar(&f.manifest, "manifest", f.manifest, "remove the files recorded in this manifest")
+	fs.StringVar(&f.verify, "recorder", "", fmt.Sprintf("remove the files recorded by %s (-db)", verifyInSQLite))
+	fs.StringVar(&f.dbPath, "db", f.dbPath, "path to the database used by the sqlite recorder")
+	yesNoVar(fs, false, &f.byName, "byname", "remove all files and folders named like generated ones, when neither -manifest nor -recorder tells them")
+
+	return func() int {
+		switch {
+		case f.verify != "" && f.verify != verifyInSQLite:
+			fmt.Fprintln(os.Stderr, "unknown -recorder", f.verify)
+			return exitBadArgs
+		case f.verify == "" && len(f.manifest) == 0 && f.byName != "y":
+			fmt.Fprintln(os.Stderr, "nothing tells the generated files: use -manifest, -recorder=sqlite or -byname")
+			return exitBadArgs
+		case f.verify == "":
+			f.verify = recordNone
+		}
+		f.clean = "y"
+
+		return run(f, fs, fs.Arg(0))
+	}
+}
+
+func capacityFlags(fs *flag.FlagSet, f *cmdFlags) func() int {
+	addRunFlags(fs, f, false)
+	addSyncFlags(fs, f, false)
+
+	return func() int {
+		f.capacity = "y"
+		return run(f, fs, fs.Arg(0))
+	}
+}
+
+func metadataFlags(fs *flag.FlagSet, f *cmdFlags) func() int {
+	addRunFlags(fs, f, false)
+	addSyncFlags(fs, f, false)
+	addTreeFlags(fs, f)
+	addMetadataFlags(fs, f)
+
+	return func() int {
+		f.metadata = "y"
+		return run(f, fs, fs.Arg(0))
+	}
+}
+
+func reportFlags(fs *flag.FlagSet, f *cmdFlags) func() int {
+	return func() int {
+		report, err := LoadRunReport(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitBadArgs
+		}
+
+		report.Print(os.Stdout)
+		return report.ExitCode()
+	}
+}
+
+func benchFlags(fs *flag.FlagSet, f *cmdFlags) func() int {
+	fs.IntVar(&f.maxParallel, "maxparallel", f.maxParallel, "max parallel processing streams. default(0) = CPU cores - 1")
+	fs.StringVar(&f.report, "report", f.report, "write the results as JSON to this file")
+	duration := fs.Duration("duration", 2*time.Second, "how long to measure every content source and hash algorithm")
+	bufSize := fs.String("buffer", "1MB", "size of the buffers generated and hashed")
+
+	return func() int {
+		size, err := toNum(*bufSize)
+		if err != nil || size <= 0 || *duration <= 0 || f.maxParallel < 0 {
+			fmt.Fprintln(os.Stderr, "bad -buffer, -duration or -maxparallel", err)
+			return exitBadArgs
+		}
+
+		workers := maxParallel(f.maxParallel)
+		fmt.Println("measuring with", workers, "streams of", sizeFormat.ToString(size), "buffers for", *duration, "each")
+		report := NewRunReport(fs, "")
+		report.Bench = BenchCmd(context.Background(), *duration, workers, int(size))
+		printBench(os.Stdout, report.Bench)
+
+		report.Finish(nil, nil, nil, nil, nil)
+		if len(f.report) > 0 {
+			if err := report.WriteFile(f.report); err != nil {
+				fmt.Fprintln(os.Stderr, "could not write the report:", err)
+				return exitIOError
+			}
+		}
+
+		return exitSuccess
+	}
+}
+
+//runFlagsOnly runs the original command line: disktest [opts] path, with -generate/-verify/-capacity/-metadata selecting what to do
+func runFlagsOnly(args []string) int {
+	fs := flag.NewFlagSet("disktest", flag.ContinueOnError)
+	f := defaultFlags()
+	fs.StringVar(&f.generate, "generate", f.generate, "generate files at the location specified: y/n")
+	fs.StringVar(&f.capacity, "capacity", f.capacity, "fill the free space at the location specified and read it back to detect fake capacity: y/n. replaces -generate and -verify")
+	fs.StringVar(&f.metadata, "metadata", f.metadata, "create, stat and delete -files tiny files and measure the rate of each: y/n. replaces -generate and -verify")
+	fs.StringVar(&f.verify, "verify", f.verify, fmt.Sprintf("verify results via %s/%s/%s/none. %s needs no recorder, but requires -seed", verifyInMem, verifyInSQLite, verifySeeded, verifySeeded))
+	addRunFlags(fs, f, true)
+	addContentFlags(fs, f, true)
+	addSyncFlags(fs, f, true)
+	addTreeFlags(fs, f)
+	addRecorderFlags(fs, f)
+	addVerifyFlags(fs, f, true)
+	addMetadataFlags(fs, f)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: disktest [opts] path")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitSuccess
+		}
+		return exitBadArgs
+	}
+	fmt.Fprintln(os.Stderr, "WARN: disktest [opts] path is deprecated, use one of the commands: disktest generate|verify|clean|capacity|metadata [opts] path")
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "path not provided. syntax: disktest [opts] path")
+		fs.PrintDefaults()
+		return exitBadArgs
+	}
+
+	switch f.verify {
+	case verifyInMem, verifyInSQLite, verifySeeded, recordNone:
+	case "n":
+		f.verify = recordNone
+	default:
+		fmt.Fprintln(os.Stderr, "unknown -verify", f.verify)
+		return exitBadArgs
+	}
+
+	return run(f, fs, fs.Arg(0))
+}
+
+//addRunFlags adds the flags all commands that touch the disk share. legacy: y/n instead of boolean flags
+func addRunFlags(fs *flag.FlagSet, f *cmdFlags, legacy bool) {
+	fs.IntVar(&f.maxParallel, "maxparallel", f.maxParallel, "max parallel processing streams. default(0) = CPU cores - 1")
+	fs.StringVar(&f.onError, "onerror", f.onError, "what to do on read/write errors: stop (on the first one), continue, or threshold=N (stop after N errors). all errors are reported at the end")
+	fs.StringVar(&f.cache, "cache", f.cache, fmt.Sprintf("how reads and writes treat the OS page cache: %s it, %s files from it (fsync after write, fadvise before read) or %s it (O_DIRECT), so verification reads from the device", cacheUse, cacheDrop, cacheBypass))
+	fs.StringVar(&f.report, "report", f.report, "write a JSON summary of the run to this file")
+	fs.StringVar(&f.cpuprofile, "cpuprofile", "", "write cpu profile to file")
+	fs.StringVar(&f.memprofile, "memprofile", "", "write mem profile to file")
+	yesNoVar(fs, legacy, &f.waitBeforeExit, "waitbeforeexit", "wait for return before exiting")
+}
+
+//addContentFlags adds the flags of what generate writes
+func addContentFlags(fs *flag.FlagSet, f *cmdFlags, legacy bool) {
+	fs.StringVar(&f.size, "size", f.size, "the total size of files to generate: absolute (5.5GB), free, free-2GB or 95% (of free space)")
+	fs.StringVar(&f.sizes, "sizes", f.sizes, fmt.Sprintf("file size distribution: a preset (%s), fixed=SIZE, classes=MIN-MAX:SHARE%%,... (shares of -size), histogram=MIN-MAX:WEIGHT,... (weights of the number of files) or a .json file with one of these", strings.Join(sizePresetNames(), "/")))
+	fs.Int64Var(&f.seed, "seed", f.seed, "derive file content from this seed instead of random data, so it can be verified without recorded hashes. default(0) = random")
+	fs.StringVar(&f.hash, "hash", f.hash, fmt.Sprintf("hash algorithm of the generated files: %s. verifying against a manifest or a sqlite recorder uses the one it was generated with", strings.Join(hashNames(), "/")))
+	fs.StringVar(&f.partial, "partial", f.partial, fmt.Sprintf("what to do with the files being written when the run is stopped or their write fails: %s them, or %s them as partial (renamed to hidden .name.partial)", partialRemove, partialMark))
+	yesNoVar(fs, legacy, &f.resume, "resume", "continue an interrupted generation recorded in -manifest. the size, -sizes and directory tree of the interrupted run are used")
+}
+
+func addSyncFlags(fs *flag.FlagSet, f *cmdFlags, legacy bool) {
+	fs.StringVar(&f.fsync, "fsync", f.fsync, "durability of generated files: none, file (fsync once written) or every=SIZE, e.g. every=64MB. write latency includes the fsync")
+	yesNoVar(fs, legacy, &f.dirSync, "dirsync", "fsync the directory of every generated file after creating it")
+}
+
+func addTreeFlags(fs *flag.FlagSet, f *cmdFlags) {
+	fs.IntVar(&f.depth, "depth", f.depth, "levels of subfolders to generate files into: -1 = as many as the size needs, 0 = only the target path")
+	fs.IntVar(&f.fanOut, "fanout", f.fanOut, "number of subfolders of every folder")
+	fs.IntVar(&f.filesPerDir, "filesperdir", f.filesPerDir, "number of files generated into every folder")
+	fs.IntVar(&f.nameLen, "namelen", f.nameLen, "pad file and folder names to this many bytes. default(0) = file_N.tmp and subfolder_N.tmp")
+	fs.StringVar(&f.charset, "charset", f.charset, fmt.Sprintf("characters the names are padded with to -namelen: %s, %s (with spaces) or %s", charsetASCII, charsetSpaces, charsetUnicode))
+}
+
+func addRecorderFlags(fs *flag.FlagSet, f *cmdFlags) {
+	fs.StringVar(&f.manifest, "manifest", f.manifest, "manifest file to record generated files to, or to verify them against")
+	fs.StringVar(&f.dbPath, "db", f.dbPath, "path to the database used by the sqlite recorder")
+}
+
+//addVerifyFlags adds the flags of the verification after generate, or of verify
+func addVerifyFlags(fs *flag.FlagSet, f *cmdFlags, legacy bool) {
+	fs.StringVar(&f.cleanup, "cleanup", f.cleanup, fmt.Sprintf("remove the generated files once verified, like the clean command: %s, %s (keep them if the run failed) or %s", cleanupAlways, cleanupOnSuccess, cleanupNever))
+	yesNoVar(fs, legacy, &f.onlyRecorded, "onlyrecorded", "read only the recorded files, not everything at the path: faster, and other data on the disk is left alone, but not reported as extraneous")
+}
+
+func addMetadataFlags(fs *flag.FlagSet, f *cmdFlags) {
+	fs.Int64Var(&f.files, "files", f.files, "number of files for -metadata")
+	fs.StringVar(&f.metadataSize, "metadatasize", f.metadataSize, "files of -metadata are 0 to this size, 0 for empty files")
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+//yesNoVar adds a y/n string flag to the legacy command line, a boolean flag to the subcommands
+func yesNoVar(fs *flag.FlagSet, legacy bool, value *string, name string, usage string) {
+	if legacy {
+		fs.StringVar(value, name, *value, usage+": y/n")
+		return
+	}
+
+	fs.Var(yesNoFlag{value}, name, usage)
+}
+
+//maxParallel resolves -maxparallel: default(0) = CPU cores - 1
+func maxParallel(flagValue int) int {
+	if flagValue > 0 {
+		return flagValue
+	}
+
+	if cpus := runtime.NumCPU() - 1; cpus > 0 {
+		return cpus
+	}
+	return 1
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCommandArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"typo"},
+		{"generate"},
+		{"generate", "-bogus", "path"},
+		{"generate", "a", "b"},
+		{"generate", "-recorder=bogus", "path"},
+		{"generate", "-recorder=none", "path"},
+		{"generate", "-recorder=none", "-seed=1", "path"},
+		{"generate", "-cleanup=bogus", "path"},
+		{"verify", "path"},
+		{"verify", "-recorder=mem", "path"},
+		{"verify", "-recorder=bogus", "-seed=1", "path"},
+		{"clean", "path"},
+		{"clean", "-recorder=mem", "path"},
+		{"bench", "extra"},
+		{"bench", "-duration=0"},
+		{"report", "/nonexistent/report.json"},
+		{"-verify=bogus", "path"},
+	} {
+		if code := runCommand(args); code != exitBadArgs {
+			t.Error(args, "expected exit code", exitBadArgs, "got", code)
+		}
+	}
+
+	for _, args := range [][]string{{"help"}, {"-h"}, {"help", "generate"}, {"verify", "-h"}} {
+		if code := runCommand(args); code != exitSuccess {
+			t.Error(args, "expected exit code", exitSuccess, "got", code)
+		}
+	}
+}
+
+func TestYesNoFlag(t *testing.T) {
+	value := "n"
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	yesNoVar(fs, false, &value, "resume", "")
+
+	if err := fs.Parse([]string{"-resume"}); err != nil || value != "y" {
+		t.Error("expected y, got", value, err)
+	}
+	if err := fs.Parse([]string{"-resume=false"}); err != nil || value != "n" {
+		t.Error("expected n, got", value, err)
+	}
+	if err := fs.Parse([]string{"-resume=maybe"}); err == nil {
+		t.Error("expected error")
+	}
+
+	legacy := flag.NewFlagSet("test", flag.ContinueOnError)
+	yesNoVar(legacy, true, &value, "resume", "")
+	if err := legacy.Parse([]string{"-resume=y"}); err != nil || value != "y" {
+		t.Error("expected y, got", value, err)
+	}
+}
+
+func TestRunCommandGenerateVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "volume")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, "manifest.jsonl")
+	report := filepath.Join(dir, "report.json")
+
+	if code := runCommand([]string{"generate", "-size=2MB", "-sizes=fixed=512KB", "-maxparallel=1", "-verify=false", "-manifest=" + manifest, root}); code != exitSuccess {
+		t.Fatal("generate: expected exit code", exitSuccess, "got", code)
+	}
+	if code := runCommand([]string{"verify", "-maxparallel=1", "-manifest=" + manifest, "-report=" + report, "-cleanup=onsuccess", root}); code != exitSuccess {
+		t.Fatal("verify: expected exit code", exitSuccess, "got", code)
+	}
+	if left, _ := ioutil.ReadDir(root); len(left) != 0 {
+		t.Error("expected the files to be cleaned up, got", len(left))
+	}
+	if code := runCommand([]string{"report", report}); code != exitSuccess {
+		t.Error("report: expected exit code", exitSuccess, "got", code)
+	}
+}
+
+func TestRunCommandSqliteHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "volume")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	db := filepath.Join(dir, "disktest.db")
+
+	if code := runCommand([]string{"generate", "-size=1MB", "-sizes=fixed=512KB", "-maxparallel=1", "-verify=false", "-recorder=sqlite", "-db=" + db, "-hash=" + hashXXHash, root}); code != exitSuccess {
+		t.Fatal("generate: expected exit code", exitSuccess, "got", code)
+	}
+	// the hash algorithm recorded is used, not the default one
+	if code := runCommand([]string{"verify", "-maxparallel=1", "-recorder=sqlite", "-db=" + db, root}); code != exitSuccess {
+		t.Error("verify: expected exit code", exitSuccess, "got", code)
+	}
+}
+
+func TestMaxParallel(t *testing.T) {
+	if maxParallel(3) != 3 {
+		t.Error("expected the flag value")
+	}
+	if maxParallel(0) < 1 {
+		t.Error("expected at least 1 stream")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+const maxReportedClusters = 5
+
+type (
+	byteRange struct {
+		from, to int64
+	}
+
+	fileCorruption struct {
+		file      *TempFile
+		missing   bool
+		err       error
+		ranges    []byteRange
+		corrupted int64
+	}
+
+	//CorruptionReport describes where the data of the files that failed verification was lost
+	CorruptionReport struct {
+		files          []*fileCorruption
+		totalCorrupted int64
+		totalMissing   int64
+		// block index -> number of files corrupted at that block
+		blockHits map[int64]int
+	}
+
+	blockCluster struct {
+		block int64
+		hits  int
+	}
+)
+
+func (br byteRange) String() string {
+	return fmt.Sprintf("[%d-%d)", br.from, br.to)
+}
+
+//NewCorruptionReport re-reads files that failed verification and compares them with their recorded block checksums
+func NewCorruptionReport(ctx context.Context, files []*TempFile) *CorruptionReport {
+	report := &CorruptionReport{
+		files:     make([]*fileCorruption, 0, len(files)),
+		blockHits: make(map[int64]int),
+	}
+
+	for _, file := range files {
+		report.add(analyzeCorruption(ctx, file))
+	}
+
+	return report
+}
+
+func analyzeCorruption(ctx context.Context, file *TempFile) *fileCorruption {
+	res := &fileCorruption{file: file}
+
+	actual, err := GetFileBlockChecksums(ctx, file.path)
+	if os.IsNotExist(err) {
+		res.missing = true
+		return res
+	}
+	if err != nil {
+		res.err = err
+	}
+
+	blocksNum := (file.size + checksumBlockSize - 1) / checksumBlockSize
+	for i := int64(0); i < blocksNum; i++ {
+		// without recorded checksums (or when unreadable) the corruption can't be localized: the whole file is lost
+		if int64(len(file.blocks)) == blocksNum && err == nil && i < int64(len(actual)) && actual[i] == file.blocks[i] {
+			continue
+		}
+
+		from := i * checksumBlockSize
+		to := from + checksumBlockSize
+		if to > file.size {
+			to = file.size
+		}
+
+		last := len(res.ranges) - 1
+		if last >= 0 && res.ranges[last].to == from {
+			res.ranges[last].to = to
+		} else {
+			res.ranges = append(res.ranges, byteRange{from: from, to: to})
+		}
+		res.corrupted += to - from
+	}
+
+	return res
+}
+
+func (report *CorruptionReport) add(fc *fileCorruption) {
+	report.files = append(report.files, fc)
+	if fc.missing {
+		report.totalMissing += fc.file.size
+		return
+	}
+
+	report.totalCorrupted += fc.corrupted
+	for _, r := range fc.ranges {
+		for block := r.from / checksumBlockSize; block*checksumBlockSize < r.to; block++ {
+			report.blockHits[block]++
+		}
+	}
+}
+
+//Print writes the report in a human readable form
+func (report *CorruptionReport) Print(w io.Writer) {
+	if len(report.files) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "Corruption report:")
+	corruptedFiles, missingFiles, toEndFiles := 0, 0, 0
+	for _, fc := range report.files {
+		switch {
+		case fc.missing:
+			missingFiles++
+			fmt.Fprintln(w, " ", fc.file.path, "is missing")
+		case fc.corrupted == 0:
+			fmt.Fprintln(w, " ", fc.file.path, "all blocks match, but the file is not what was recorded")
+		default:
+			corruptedFiles++
+			if fc.ranges[len(fc.ranges)-1].to == fc.file.size {
+				toEndFiles++
+			}
+
+			ranges := make([]string, len(fc.ranges))
+			for i, r := range fc.ranges {
+				ranges[i] = r.String()
+			}
+			fmt.Fprintf(w, "  %s: %s of %s corrupted at %s\n",
+				fc.file.path, sizeFormat.ToString(fc.corrupted), sizeFormat.ToString(fc.file.size), strings.Join(ranges, " "))
+			if fc.err != nil {
+				fmt.Fprintln(w, "   ", fc.err)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Total: %d files corrupted, %s corrupted; %d files missing, %s missing\n",
+		corruptedFiles, sizeFormat.ToString(report.totalCorrupted), missingFiles, sizeFormat.ToString(report.totalMissing))
+
+	if corruptedFiles == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%d of %d corrupted files are corrupted up to their end\n", toEndFiles, corruptedFiles)
+	if toEndFiles*2 > corruptedFiles {
+		fmt.Fprintln(w, "WARN: this is typical of counterfeit drives wrapping around at their real capacity")
+	}
+
+	clusters := report.clusters()
+	if len(clusters) > 0 {
+		fmt.Fprintln(w, "Most corrupted offsets:")
+	}
+	for _, c := range clusters {
+		fmt.Fprintf(w, "  block at offset %s corrupted in %d files\n", sizeFormat.ToString(c.block*checksumBlockSize), c.hits)
+	}
+}
+
+//clusters returns the block offsets corrupted in the most files, if any is corrupted in more than one
+func (report *CorruptionReport) clusters() []blockCluster {
+	res := make([]blockCluster, 0, len(report.blockHits))
+	for block, hits := range report.blockHits {
+		if hits > 1 {
+			res = append(res, blockCluster{block: block, hits: hits})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].hits == res[j].hits {
+			return res[i].block < res[j].block
+		}
+		return res[i].hits > res[j].hits
+	})
+
+	if len(res) > maxReportedClusters {
+		res = res[:maxReportedClusters]
+	}
+
+	return res
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewCorruptionReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	size := 4 * checksumBlockSize
+	data := bytes.Repeat([]byte{1}, int(size))
+	bc := newBlockChecksummer()
+	bc.Write(data)
+
+	// corrupted 2nd block
+	corrupted := filepath.Join(dir, "corrupted")
+	data[checksumBlockSize+1] = 0
+	ioutil.WriteFile(corrupted, data, 0644)
+
+	// lost the last 2 blocks
+	truncated := filepath.Join(dir, "truncated")
+	ioutil.WriteFile(truncated, data[:2*checksumBlockSize], 0644)
+
+	report := NewCorruptionReport(context.Background(), []*TempFile{
+		{path: corrupted, size: int64(size), blocks: bc.Sums()},
+		{path: truncated, size: int64(size), blocks: bc.Sums()},
+		{path: filepath.Join(dir, "missing"), size: 5},
+	})
+
+	if report.totalMissing != 5 {
+		t.Error("expected 5 missing bytes, got", report.totalMissing)
+	}
+
+	expectedRanges := [][]byteRange{
+		{{from: checksumBlockSize, to: 2 * checksumBlockSize}},
+		{{from: checksumBlockSize, to: int64(size)}},
+	}
+	for i, expected := range expectedRanges {
+		fc := report.files[i]
+		if len(fc.ranges) != len(expected) || fc.ranges[0] != expected[0] {
+			t.Error("expected", expected, "got", fc.ranges, "for", fc.file.path)
+		}
+	}
+
+	if report.totalCorrupted != 4*checksumBlockSize {
+		t.Error("expected", 4*checksumBlockSize, "corrupted bytes, got", report.totalCorrupted)
+	}
+
+	clusters := report.clusters()
+	if len(clusters) != 1 || clusters[0].block != 1 || clusters[0].hits != 2 {
+		t.Error("expected the 2nd block to be corrupted in 2 files, got", clusters)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "missing") {
+		t.Error("expected missing file to be reported", out.String())
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import (
+	"errors"
+)
+
+//diskSpace returns the total and available to unprivileged users size of the filesystem at path
+func diskSpace(path string) (int64, int64, error) {
+	return 0, 0, errors.New("querying disk space is not supported on this platform")
+}
+
+//diskInodes returns the total and free number of inodes of the filesystem at path
+func diskInodes(path string) (int64, int64, error) {
+	return 0, 0, errors.New("querying inodes is not supported on this platform")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//categories of the errors collected by RunReport
+const (
+	errCategoryWrite  = "write"
+	errCategoryRead   = "read"
+	errCategoryRecord = "record"
+	errCategoryWalk   = "walk"
+	errCategoryOther  = "other"
+)
+
+type (
+	//FileError is an error processing the file at Path
+	FileError struct {
+		Path string
+		// write, read, record or walk
+		Category string
+		Err      error
+	}
+
+	//errorPolicy tells when to stop the run because of errors
+	errorPolicy struct {
+		// stop once this many errors were collected. 0 never stops
+		threshold int
+	}
+)
+
+func newFileError(category string, path string, err error) *FileError {
+	return &FileError{Path: path, Category: category, Err: err}
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Category, e.Path, e.Err)
+}
+
+//Unwrap returns the underlying error
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+//parseErrorPolicy parses -onerror: stop (on the first error), continue or threshold=N
+func parseErrorPolicy(spec string) (errorPolicy, error) {
+	switch spec {
+	case "stop":
+		return errorPolicy{threshold: 1}, nil
+	case "continue":
+		return errorPolicy{}, nil
+	}
+
+	if strings.HasPrefix(spec, "threshold=") {
+		threshold, err := strconv.Atoi(strings.TrimPrefix(spec, "threshold="))
+		if err != nil || threshold <= 0 {
+			return errorPolicy{}, fmt.Errorf("bad error threshold in %s", spec)
+		}
+		return errorPolicy{threshold: threshold}, nil
+	}
+
+	return errorPolicy{}, errors.New("unknown error policy " + spec)
+}
+
+//shouldStop tells if the run has to stop after errors were collected
+func (policy errorPolicy) shouldStop(errors int) bool {
+	return policy.threshold > 0 && errors >= policy.threshold
+}
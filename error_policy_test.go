@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestParseErrorPolicy(t *testing.T) {
+	tests := []struct {
+		spec      string
+		threshold int
+		fail      bool
+	}{
+		{"stop", 1, false},
+		{"continue", 0, false},
+		{"threshold=10", 10, false},
+		{"threshold=0", 0, true},
+		{"threshold=x", 0, true},
+		{"sometimes", 0, true},
+	}
+
+	for _, test := range tests {
+		policy, err := parseErrorPolicy(test.spec)
+		if (err != nil) != test.fail || policy.threshold != test.threshold {
+			t.Error("unexpected policy for", test.spec, policy, err)
+		}
+	}
+}
+
+func TestErrorPolicyShouldStop(t *testing.T) {
+	if (errorPolicy{threshold: 1}).shouldStop(0) || !(errorPolicy{threshold: 1}).shouldStop(1) {
+		t.Error("stop should stop on the first error")
+	}
+
+	if (errorPolicy{}).shouldStop(1000) {
+		t.Error("continue should never stop")
+	}
+
+	if (errorPolicy{threshold: 3}).shouldStop(2) || !(errorPolicy{threshold: 3}).shouldStop(3) {
+		t.Error("threshold should stop at 3 errors")
+	}
+}
+
+func TestFileError(t *testing.T) {
+	err := error(newFileError(errCategoryRead, "/data/a", os.ErrPermission))
+	if err.Error() != "read /data/a: "+os.ErrPermission.Error() {
+		t.Error("unexpected message", err)
+	}
+
+	if !errors.Is(err, os.ErrPermission) {
+		t.Error("expected the underlying error to be unwrapped")
+	}
+}
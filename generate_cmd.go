@@ -16,6 +16,9 @@ type (
 	volumePathFolder struct {
 		basePath string
 		filesNum rune
+		// levels below the volume root
+		depth int
+		shape *treeShape
 	}
 
 	tempFileSizeConstraint struct {
@@ -26,10 +29,8 @@ type (
 )
 
 const (
-	numFilesPerFolder  = 500
-	numSubfolders      = 10
-	maxLargeFilesShare = .5
-	maxMedFilesShare   = .35
+	numFilesPerFolder = 500
+	numSubfolders     = 10
 )
 
 var (
@@ -43,12 +44,21 @@ func GenerateCmd(ctx context.Context, rootPath string, size int64, recorder *IFi
 	writeFn writeFunc) *sync.WaitGroup {
 	chanBuff := GetIntOrDefault(ctx, "max_parallel", 1)
 	fmt.Println("generating using", chanBuff, "concurrent writers")
-
-	workQueue := generateVolume(ctx, chanBuff, rootPath, size, errorChan)
+	ctx = context.WithValue(ctx, "volume_root", rootPath)
+
+	// the paths generated by the run being resumed are left as they are. a snapshot taken before generating,
+	// so the recorder isn't read while recording
+	var recorded func(path string) bool
+	if paths, ok := ctx.Value("recorded_paths").(map[string]bool); ok && len(paths) > 0 {
+		recorded = func(path string) bool {
+			return paths[path]
+		}
+	}
+	workQueue := generateVolume(ctx, chanBuff, rootPath, size, recorded, errorChan)
 
 	doneQueue := make(chan (*TempFile))
-	var wg sync.WaitGroup
-	wg.Add(chanBuff)
+	var writers sync.WaitGroup
+	writers.Add(chanBuff)
 	genDoneCh := make(chan interface{})
 	go func() {
 		defer close(doneQueue)
@@ -59,17 +69,26 @@ func GenerateCmd(ctx context.Context, rootPath string, size int64, recorder *IFi
 		}
 		//start file producing routines
 		for i := 0; i < chanBuff; i++ {
-			go writeFn(ctx, workQueue, doneQueue, &wg, errorChan)
+			go writeFn(ctx, workQueue, doneQueue, &writers, errorChan)
 		}
 
-		wg.Wait()
+		writers.Wait()
 	}()
 
+	// generation is done once the last written file has been recorded, not just written
+	var wg sync.WaitGroup
+	wg.Add(1)
 	if recorder != nil {
-		go recordVolume(ctx, recorder, doneQueue, errorChan)
+		go func() {
+			defer wg.Done()
+			recordVolume(ctx, recorder, doneQueue, errorChan)
+		}()
 		go reportGenerationProgressEveryMinute(ctx, size, recorder, genDoneCh)
 	} else {
-		go logProgressToStdout(ctx, doneQueue, size)
+		go func() {
+			defer wg.Done()
+			logProgressToStdout(ctx, doneQueue, size)
+		}()
 	}
 
 	return &wg
@@ -96,7 +115,7 @@ mainLoop:
 
 func logProgressToStdout(ctx context.Context, doneQueue <-chan (*TempFile), totalSize int64) {
 	processed := int64(0)
-	for workItem := range processOrDone(ctx, doneQueue) {
+	for workItem := range doneQueue {
 		processed += workItem.size
 		fmt.Printf("generated: %v. %2.3f%% done.\n", workItem, float64(processed*100)/float64(totalSize))
 	}
@@ -105,10 +124,20 @@ func logProgressToStdout(ctx context.Context, doneQueue <-chan (*TempFile), tota
 func writeVolume(ctx context.Context, workQueue <-chan (*TempFile), doneQueue chan<- (*TempFile), wg *sync.WaitGroup, errChan chan<- error) {
 	defer wg.Done()
 
+	// random content of this writer only: no contention with the other writers
+	ctx = context.WithValue(ctx, "random_stream", newRandomStream())
+
 	for workItem := range processOrDone(ctx, workQueue) {
 		err := writeRandomFile(ctx, workItem)
+		if _, cancelled := err.(*CancelledError); cancelled {
+			// the partial file is gone: nothing to report or record
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
 		if err != nil {
+			// not written as planned: nothing to record
 			errChan <- err
+			continue
 		}
 		doneQueue <- workItem
 	}
@@ -116,33 +145,43 @@ func writeVolume(ctx context.Context, workQueue <-chan (*TempFile), doneQueue ch
 
 func writeRandomFile(ctx context.Context, workItem *TempFile) error {
 	fmt.Fprintln(os.Stdout, "generating", sizeFormat.ToString(workItem.size), workItem.path)
-	fileHash, err := GenerateLen(ctx, workItem.size, workItem.path)
+	var fileHash string
+	var blocks []uint32
+	var err error
+	start := time.Now()
+	if seed := GetInt64OrDefault(ctx, "seed", 0); seed != 0 {
+		key := seededKey(GetStringOrDefault(ctx, "volume_root", ""), workItem.path)
+		fileHash, blocks, err = GenerateSeeded(ctx, workItem.size, workItem.path, NewSeededContent(seed, key))
+	} else {
+		fileHash, blocks, err = GenerateLen(ctx, workItem.size, workItem.path)
+	}
+	if _, cancelled := err.(*CancelledError); cancelled {
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("error while generating %s: %v", workItem.path, err)
+		discardPartialFile(ctx, workItem.path)
+		return newFileError(errCategoryWrite, workItem.path, err)
 	}
 	workItem.hash = fileHash
+	workItem.blocks = blocks
+	GetIOStats(ctx, "write_stats").Record(workItem.size, time.Since(start))
 
 	return nil
 }
 
-//generateVolume generates the volume of TempFiles into channel it returns. async
-func generateVolume(ctx context.Context, chanBuff int, basePath string, maxVolumeSize int64, errChan chan<- error) <-chan (*TempFile) {
+//generateVolume generates the volume of TempFiles into channel it returns. async.
+//Paths for which skip (if not nil) is true are left out, the volume goes to the following ones
+func generateVolume(ctx context.Context, chanBuff int, basePath string, maxVolumeSize int64, skip func(path string) bool, errChan chan<- error) <-chan (*TempFile) {
 	rand.Seed(time.Now().UnixNano())
 
-	var maxTotalLargeFileSize int64 = int64(float64(maxVolumeSize) * maxLargeFilesShare)
-	var maxTotalMedFileSize int64 = int64(float64(maxVolumeSize) * maxMedFilesShare)
-	maxTotalSmallFileSize := maxVolumeSize - (maxTotalLargeFileSize + maxTotalMedFileSize)
-
-	sizeGenerators := []func() int64{
-		getRandomFileSizeFunc(&largeFileSizeConstraint, maxTotalLargeFileSize),
-		getRandomFileSizeFunc(&medFileSizeConstraint, maxTotalMedFileSize),
-		getRandomFileSizeFunc(&smallFileSizeConstraint, maxTotalSmallFileSize),
-	}
+	sizeGenerators := getSizeProfile(ctx).sizeGenerators(maxVolumeSize)
+	shape := getTreeShape(ctx)
 
 	q := NewQueue()
 	q.QueueEnqueue(volumePathFolder{
 		basePath: basePath,
-		filesNum: numFilesPerFolder,
+		filesNum: rune(shape.filesPerDir),
+		shape:    shape,
 	})
 
 	workChan := make(chan (*TempFile), chanBuff)
@@ -150,10 +189,9 @@ func generateVolume(ctx context.Context, chanBuff int, basePath string, maxVolum
 		defer close(workChan)
 
 		for q.QueueSize() != 0 && maxVolumeSize > 0 {
-			select {
-			case <-ctx.Done():
+			if ctx.Err() != nil {
 				fmt.Println("generateVolume: context exit")
-			default:
+				return
 			}
 			queueElement, err := q.QueueDequeue()
 
@@ -163,17 +201,23 @@ func generateVolume(ctx context.Context, chanBuff int, basePath string, maxVolum
 			}
 
 			path := (*queueElement).(volumePathFolder)
-			maxVolumeSize = generateFilesForPathElement(&path, sizeGenerators, maxVolumeSize, workChan)
+			maxVolumeSize = generateFilesForPathElement(ctx, &path, sizeGenerators, maxVolumeSize, skip, workChan)
 
 			if maxVolumeSize <= 0 {
 				break
 			}
 
+			if !shape.subfolders(path.depth) {
+				continue
+			}
+
 			// more to generate in subfolders
-			for i := 0; i < numSubfolders; i++ {
+			for i := 0; i < shape.fanOut; i++ {
 				_, err := q.QueueEnqueue(volumePathFolder{
-					basePath: filepath.Join(path.basePath, fmt.Sprintf("subfolder_%d.tmp", i)),
-					filesNum: numFilesPerFolder,
+					basePath: filepath.Join(path.basePath, shape.folderName(i)),
+					filesNum: rune(shape.filesPerDir),
+					depth:    path.depth + 1,
+					shape:    shape,
 				})
 				if err != nil {
 					errChan <- err
@@ -181,22 +225,28 @@ func generateVolume(ctx context.Context, chanBuff int, basePath string, maxVolum
 				}
 			}
 		}
+
+		if maxVolumeSize > 0 && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, "WARN: the directory tree is full,", sizeFormat.ToString(maxVolumeSize), "not generated. Allow more depth, fan-out or files per directory")
+		}
 	}()
 
 	return workChan
 }
 
 func generateFilesForPathElement(
+	ctx context.Context,
 	pathElement *volumePathFolder,
 	sizeGenerators []func() int64,
 	maxVolumeSize int64,
+	skip func(path string) bool,
 	producerQueue chan<- (*TempFile),
 ) int64 {
-	for pathElement.filesNum > 0 && maxVolumeSize > 0 {
+	for pathElement.filesNum > 0 && maxVolumeSize > 0 && ctx.Err() == nil {
 		fileNumBeforeGenerators := pathElement.filesNum
 		for _, sizeGen := range sizeGenerators {
 			// if generated enough for this folder: back out
-			if pathElement.filesNum == 0 {
+			if !pathElement.skipRecorded(skip) {
 				break
 			}
 
@@ -207,14 +257,18 @@ func generateFilesForPathElement(
 				continue
 			}
 
-			addToProducerQueue(generatedFileSize, pathElement, producerQueue)
+			if !addToProducerQueue(ctx, generatedFileSize, pathElement, producerQueue) {
+				return maxVolumeSize
+			}
 			maxVolumeSize -= generatedFileSize
 
 		}
 
 		// corner case for last file in the volume, that might be too small.
-		if pathElement.filesNum == fileNumBeforeGenerators && maxVolumeSize > 0 {
-			addToProducerQueue(maxVolumeSize, pathElement, producerQueue)
+		if pathElement.filesNum == fileNumBeforeGenerators && maxVolumeSize > 0 && pathElement.skipRecorded(skip) {
+			if !addToProducerQueue(ctx, maxVolumeSize, pathElement, producerQueue) {
+				return maxVolumeSize
+			}
 			maxVolumeSize = 0
 		}
 	}
@@ -222,10 +276,29 @@ func generateFilesForPathElement(
 	return maxVolumeSize
 }
 
-func addToProducerQueue(size int64, pathElement *volumePathFolder, queue chan<- (*TempFile)) {
-	pathToGenerateAt := filepath.Join(pathElement.basePath, fmt.Sprintf("file_%d.tmp", numFilesPerFolder-pathElement.filesNum))
-	queue <- &TempFile{path: pathToGenerateAt, size: size}
+func (pathElement *volumePathFolder) nextFilePath() string {
+	return filepath.Join(pathElement.basePath, pathElement.shape.fileName(pathElement.shape.filesPerDir-int(pathElement.filesNum)))
+}
+
+//skipRecorded moves past the paths skip is true for. false if no files are left in the folder
+func (pathElement *volumePathFolder) skipRecorded(skip func(path string) bool) bool {
+	for skip != nil && pathElement.filesNum > 0 && skip(pathElement.nextFilePath()) {
+		pathElement.filesNum--
+	}
+
+	return pathElement.filesNum > 0
+}
+
+//addToProducerQueue queues the next file of the folder. false if ctx was cancelled first
+func addToProducerQueue(ctx context.Context, size int64, pathElement *volumePathFolder, queue chan<- (*TempFile)) bool {
+	select {
+	case queue <- &TempFile{path: pathElement.nextFilePath(), size: size}:
+	case <-ctx.Done():
+		return false
+	}
+
 	pathElement.filesNum--
+	return true
 }
 
 func getRandomFileSizeFunc(minMaxConstraint *tempFileSizeConstraint, capConstraint int64) func() int64 {
@@ -234,7 +307,10 @@ func getRandomFileSizeFunc(minMaxConstraint *tempFileSizeConstraint, capConstrai
 			return 0
 		}
 
-		retVal := minMaxConstraint.min + rand.Int63n(minMaxConstraint.max-minMaxConstraint.min)
+		retVal := minMaxConstraint.min
+		if minMaxConstraint.max > minMaxConstraint.min {
+			retVal += rand.Int63n(minMaxConstraint.max - minMaxConstraint.min)
+		}
 
 		if retVal > capConstraint {
 			return capConstraint
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
@@ -27,7 +29,7 @@ func TestGenerateVolume(t *testing.T) {
 	size := int64(131 * sizeFormat.GB)
 	errCh := make(chan error)
 
-	workQ := generateVolume(context.Background(), 2, rootPath, size, errCh)
+	workQ := generateVolume(context.Background(), 2, rootPath, size, nil, errCh)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -62,6 +64,30 @@ func TestGenerateVolume(t *testing.T) {
 	wg.Wait()
 }
 
+func TestGenerateVolumeSkipsRecorded(t *testing.T) {
+	rootPath := "build/test"
+	size := int64(20 * sizeFormat.GB)
+	errCh := make(chan error)
+
+	recorded := map[string]bool{
+		filepath.Join(rootPath, "file_0.tmp"): true,
+		filepath.Join(rootPath, "file_2.tmp"): true,
+	}
+	workQ := generateVolume(context.Background(), 2, rootPath, size, func(path string) bool { return recorded[path] }, errCh)
+
+	totalGenerated := int64(0)
+	for val := range workQ {
+		if recorded[val.path] {
+			t.Error("recorded path generated again", val.path)
+		}
+		totalGenerated += val.size
+	}
+
+	if size != totalGenerated {
+		t.Error("exected", sizeFormat.ToString(size), "but generated only", sizeFormat.ToString(totalGenerated))
+	}
+}
+
 func TestLogProgressToStdout(t *testing.T) {
 	ch := make(chan (*TempFile))
 	go func() {
@@ -71,9 +97,14 @@ func TestLogProgressToStdout(t *testing.T) {
 
 	logProgressToStdout(context.Background(), ch, 2)
 
+	// written files are drained after cancel, until the writers close the queue
 	ch = make(chan (*TempFile))
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
+	go func() {
+		defer close(ch)
+		ch <- &TempFile{size: 1}
+	}()
 	logProgressToStdout(ctx, ch, 1)
 }
 
@@ -128,6 +159,33 @@ func TestWriteVolume(t *testing.T) {
 	}
 }
 
+func TestWriteVolumeFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	workQ := make(chan (*TempFile), 2)
+	workQ <- &TempFile{path: "/non-existent/a", size: sizeFormat.KB}
+	workQ <- &TempFile{path: filepath.Join(dir, "b"), size: sizeFormat.KB}
+	close(workQ)
+	doneQ := make(chan (*TempFile), 2)
+	errCh := make(chan error, 2)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	writeVolume(context.Background(), workQ, doneQ, &wg, errCh)
+
+	// the failed write is reported, but not passed on to be recorded
+	if len(errCh) != 1 || len(doneQ) != 1 {
+		t.Fatal("expected 1 error and 1 written file, got", len(errCh), len(doneQ))
+	}
+	if written := <-doneQ; written.path != filepath.Join(dir, "b") || len(written.hash) == 0 {
+		t.Error("unexpected written file", written)
+	}
+}
+
 func TestWriteRandomFile(t *testing.T) {
 	defer os.Remove("./a")
 	tmpFile := TempFile{
@@ -180,3 +238,16 @@ func TestGetRandomFileSizeFunc(t *testing.T) {
 		t.Error("generated values should have been between", constraint.min, "and", cap, "but was", generated3)
 	}
 }
+
+func TestGenerateVolumeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+
+	workQ := generateVolume(ctx, 1, "build/test", 131*sizeFormat.GB, nil, errCh)
+	<-workQ
+	cancel()
+
+	// the producer stops instead of blocking on the queue forever
+	for range workQ {
+	}
+}
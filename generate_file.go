@@ -1,84 +1,218 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/md5"
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"os"
-	"time"
+	"path/filepath"
 
 	sizeFormat "github.com/rdev02/size-format"
 )
 
 const defaultBuffer = 20 * sizeFormat.MB
 
-//GenerateLen generates a file of size at path, returns MD5 hash.
-func GenerateLen(ctx context.Context, size int64, path string) (string, error) {
+//what is done with a file cancelled while being generated
+const (
+	partialRemove = "remove"
+	// renamed to a hidden file, which verification skips
+	partialMark = "mark"
+
+	partialSuffix = ".partial"
+)
+
+//CancelledError is returned when the context is cancelled while a file is being generated
+type CancelledError struct {
+	Path string
+	// bytes written before the cancellation
+	Written int64
+	Err     error
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("generation of %s cancelled after %s: %v", e.Path, sizeFormat.ToString(e.Written), e.Err)
+}
+
+//Unwrap returns the context error
+func (e *CancelledError) Unwrap() error {
+	return e.Err
+}
+
+//GenerateLen generates a file of size at path, returns its hash (see newHash) and block checksums.
+//Stops within one buffer once ctx is cancelled, returning a *CancelledError
+func GenerateLen(ctx context.Context, size int64, path string) (string, []uint32, error) {
+	random := getRandomStream(ctx)
+
+	return generateFile(ctx, size, path, func(buf []byte, offset int64) {
+		random.Fill(buf)
+	})
+}
+
+//GenerateSeeded generates a file of size at path with the content derived from seeded, returns its hash and block checksums.
+func GenerateSeeded(ctx context.Context, size int64, path string, seeded *SeededContent) (string, []uint32, error) {
+	return generateFile(ctx, size, path, seeded.Fill)
+}
+
+func generateFile(ctx context.Context, size int64, path string, fill func(buf []byte, offset int64)) (string, []uint32, error) {
 	if size <= 0 {
-		return "", errors.New("size must be greater then 0")
+		return "", nil, errors.New("size must be greater then 0")
 	}
 
-	f, err := os.Create(path)
+	if ctx.Err() != nil {
+		return "", nil, &CancelledError{Path: path, Err: ctx.Err()}
+	}
+
+	if err := makeParentDir(ctx, path); err != nil {
+		return "", nil, err
+	}
+
+	f, direct, err := openForWrite(ctx, path)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer f.Close()
 
-	hash := md5.New()
-	hashedWriter := io.MultiWriter(f, hash)
+	durability := getSyncPolicy(ctx)
+	if durability.dirs {
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	hash := newHash(ctx)
+	blocks := newBlockChecksummer()
+	hashedWriter := io.MultiWriter(hash, blocks)
 	actualBuffer := size
 	if size > defaultBuffer {
 		actualBuffer = defaultBuffer
 	}
-	tmp := make([]byte, actualBuffer)
+	// write no more than the fsync interval at once
+	if durability.everyBytes > 0 && actualBuffer > durability.everyBytes {
+		actualBuffer = durability.everyBytes
+		if direct {
+			actualBuffer = alignUp(actualBuffer)
+		}
+	}
+	var tmp []byte
+	if direct {
+		tmp = alignedBuffer(int(actualBuffer))[:actualBuffer]
+	} else {
+		tmp = make([]byte, actualBuffer)
+	}
 
-	rand.Seed(time.Now().UnixNano())
-	var errorWrite error = nil
+	unsynced := int64(0)
+	for offset := int64(0); offset < size; offset += actualBuffer {
+		if ctx.Err() != nil {
+			f.Close()
+			return "", nil, cancelPartialFile(ctx, path, offset)
+		}
 
-	t := size / actualBuffer
-	for i := int64(0); i < t; i++ {
-		select {
-		case <-ctx.Done():
-			break
-		default:
+		if rem := size - offset; rem < actualBuffer {
+			tmp = tmp[:rem]
 		}
+		fill(tmp, offset)
+		hashedWriter.Write(tmp)
 
-		rand.Read(tmp)
-		_, err := hashedWriter.Write(tmp)
-		if err != nil {
-			errorWrite = err
-			break
+		out := tmp
+		if direct {
+			// direct writes are whole blocks: the padding is truncated below
+			out = tmp[:alignUp(int64(len(tmp)))]
+		}
+		if _, err := f.Write(out); err != nil {
+			return hashString(hash), blocks.Sums(), err
+		}
+
+		unsynced += int64(len(out))
+		if durability.everyBytes > 0 && unsynced >= durability.everyBytes {
+			if err := f.Sync(); err != nil {
+				return hashString(hash), blocks.Sums(), err
+			}
+			unsynced = 0
 		}
 	}
 
-	rem := size - t*actualBuffer
-	if rem > 0 {
-		tmp = make([]byte, rem)
-		rand.Read(tmp)
-		_, err := hashedWriter.Write(tmp)
-		if err != nil {
-			errorWrite = err
+	if direct && size != alignUp(size) {
+		if err := f.Truncate(size); err != nil {
+			return hashString(hash), blocks.Sums(), err
 		}
 	}
 
-	return fmt.Sprintf("%x", string(hash.Sum(nil))), errorWrite
+	if durability.perFile {
+		if err := f.Sync(); err != nil {
+			return hashString(hash), blocks.Sums(), err
+		}
+	}
+
+	return hashString(hash), blocks.Sums(), closeWritten(ctx, f)
 }
 
-//GetFileMd5 generates MD5 of the file at path
-func GetFileMd5(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+//cancelPartialFile discards the file at path with discardPartialFile
+func cancelPartialFile(ctx context.Context, path string, written int64) error {
+	discardPartialFile(ctx, path)
+
+	return &CancelledError{Path: path, Written: written, Err: ctx.Err()}
+}
+
+//discardPartialFile removes the file at path, which was not written to the end, or marks it as partial, as set by "partial_files" in ctx
+func discardPartialFile(ctx context.Context, path string) {
+	var err error
+	if GetStringOrDefault(ctx, "partial_files", partialRemove) == partialMark {
+		err = os.Rename(path, filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+partialSuffix))
+	} else {
+		err = os.Remove(path)
 	}
-	defer f.Close()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "WARN: could not clean up the partial file", path, err)
+	}
+}
 
-	h := md5.New()
-	if _, err := io.Copy(h, f); err != nil {
+//GetFileMd5 generates MD5 of the file at path, reading it as set by "cache" in ctx
+func GetFileMd5(ctx context.Context, path string) (string, error) {
+	return GetFileHash(context.WithValue(ctx, "hash", hashMD5), path)
+}
+
+//GetFileHash generates the hash of the file at path with the algorithm set by "hash" in ctx
+func GetFileHash(ctx context.Context, path string) (string, error) {
+	h := newHash(ctx)
+	if err := readFile(ctx, path, defaultBuffer, func(chunk []byte) { h.Write(chunk) }); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%x", string(h.Sum(nil))), nil
+	return hashString(h), nil
+}
+
+//CompareSeeded compares the file at path with the content derived from seeded.
+//Returns the offset of the first mismatching byte, or -1 if the file matches, and the hash of the file
+func CompareSeeded(ctx context.Context, path string, seeded *SeededContent) (int64, string, error) {
+	h := newHash(ctx)
+	expected := make([]byte, defaultBuffer)
+	mismatch := int64(-1)
+	offset := int64(0)
+	err := readFile(ctx, path, defaultBuffer, func(actual []byte) {
+		h.Write(actual)
+		if mismatch < 0 {
+			seeded.Fill(expected[:len(actual)], offset)
+			if !bytes.Equal(actual, expected[:len(actual)]) {
+				mismatch = offset + int64(firstMismatch(actual, expected[:len(actual)]))
+			}
+		}
+		offset += int64(len(actual))
+	})
+	if err != nil {
+		return -1, "", err
+	}
+
+	return mismatch, hashString(h), nil
+}
+
+func firstMismatch(a, b []byte) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	return len(a)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"strings"
 	"testing"
@@ -10,7 +11,7 @@ import (
 )
 
 func TestGenerateLen(t *testing.T) {
-	res, err := GenerateLen(context.Background(), 10*sizeformat.MB, "./a")
+	res, blocks, err := GenerateLen(context.Background(), 10*sizeformat.MB, "./a")
 	defer os.Remove("./a")
 	if err != nil {
 		t.Errorf("unexpected error %v", err)
@@ -19,10 +20,14 @@ func TestGenerateLen(t *testing.T) {
 	if len(res) <= 0 {
 		t.Errorf("unexpected non empty string, got %x", res)
 	}
+
+	if len(blocks) != 10 {
+		t.Errorf("expected 10 block checksums, got %d", len(blocks))
+	}
 }
 
 func TestGetFileMd5(t *testing.T) {
-	res, err := GetFileMd5("./res/tst")
+	res, err := GetFileMd5(context.Background(), "./res/tst")
 	if err != nil {
 		t.Errorf("unexpected error %v", err)
 	}
@@ -32,3 +37,60 @@ func TestGetFileMd5(t *testing.T) {
 		t.Errorf("expected %x, got %x", expectedHash, res)
 	}
 }
+
+func TestGenerateSeeded(t *testing.T) {
+	defer os.Remove("./a")
+	hash, _, err := GenerateSeeded(context.Background(), 3*sizeformat.MB+5, "./a", NewSeededContent(42, "a"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	mismatch, readHash, err := CompareSeeded(context.Background(), "./a", NewSeededContent(42, "a"))
+	if err != nil || mismatch != -1 || strings.Compare(hash, readHash) != 0 {
+		t.Errorf("expected a match, got mismatch at %d, hash %s vs %s, %v", mismatch, hash, readHash, err)
+	}
+
+	f, err := os.OpenFile("./a", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0, 1, 2, 3}, 2*sizeformat.MB+1)
+	f.Close()
+
+	mismatch, _, err = CompareSeeded(context.Background(), "./a", NewSeededContent(42, "a"))
+	if err != nil || mismatch < 2*sizeformat.MB+1 || mismatch > 2*sizeformat.MB+4 {
+		t.Errorf("expected mismatch around %d, got %d %v", 2*sizeformat.MB+1, mismatch, err)
+	}
+
+	if _, _, err := CompareSeeded(context.Background(), "./non-existent", NewSeededContent(42, "a")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestGenerateCancelled(t *testing.T) {
+	for _, partial := range []string{partialRemove, partialMark} {
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "partial_files", partial))
+		// cancelled while the first buffer is being filled: stops before the second one
+		_, _, err := generateFile(ctx, 3*defaultBuffer, "./a", func(buf []byte, offset int64) { cancel() })
+
+		cancelledErr, ok := err.(*CancelledError)
+		if !ok {
+			t.Fatal("expected a *CancelledError, got", err)
+		}
+		if cancelledErr.Written != defaultBuffer || !errors.Is(err, context.Canceled) {
+			t.Error("unexpected error", cancelledErr.Written, err)
+		}
+
+		if _, err := os.Stat("./a"); !os.IsNotExist(err) {
+			t.Error("expected the partial file to be gone", err)
+		}
+		_, err = os.Stat("./.a.partial")
+		if partial == partialMark && err != nil {
+			t.Error("expected the partial file to be marked", err)
+		}
+		if partial == partialRemove && !os.IsNotExist(err) {
+			t.Error("expected no marked partial file", err)
+		}
+		os.Remove("./.a.partial")
+	}
+}
@@ -3,6 +3,9 @@ module github.com/rdev02/disktest
 go 1.13
 
 require (
+	github.com/cespare/xxhash/v2 v2.1.1
+	github.com/mattn/go-sqlite3 v1.14.0
 	github.com/rdev02/size-format v0.1.0
 	github.com/sqs/goreturns v0.0.0-20181028201513-538ac6014518 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 )
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+//-hash values. md5 is the default, and the algorithm of manifests that don't name one
+const (
+	hashMD5     = "md5"
+	hashSHA256  = "sha256"
+	hashCRC32C  = "crc32c"
+	hashXXHash  = "xxhash"
+	hashBLAKE2b = "blake2b"
+)
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	hashMD5:    md5.New,
+	hashSHA256: sha256.New,
+	hashCRC32C: func() hash.Hash { return crc32.New(castagnoliTable) },
+	hashXXHash: func() hash.Hash { return xxhash.New() },
+	hashBLAKE2b: func() hash.Hash {
+		// only fails on a key longer than 64 bytes
+		h, _ := blake2b.New256(nil)
+		return h
+	},
+}
+
+//hashNames lists the supported algorithms
+func hashNames() []string {
+	names := make([]string, 0, len(hashAlgorithms))
+	for name := range hashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//checkHash tells if name is a supported algorithm
+func checkHash(name string) error {
+	if _, ok := hashAlgorithms[name]; !ok {
+		return fmt.Errorf("unknown hash algorithm %s", name)
+	}
+
+	return nil
+}
+
+//newHash returns the hash algorithm set by "hash" in ctx, md5 by default
+func newHash(ctx context.Context) hash.Hash {
+	if newFn, ok := hashAlgorithms[GetStringOrDefault(ctx, "hash", hashMD5)]; ok {
+		return newFn()
+	}
+
+	return md5.New()
+}
+
+func hashString(h hash.Hash) string {
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
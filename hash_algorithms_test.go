@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+func TestHashAlgorithms(t *testing.T) {
+	expected := map[string]string{
+		hashMD5:     "900150983cd24fb0d6963f7d28e17f72",
+		hashSHA256:  "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		hashCRC32C:  "364b3fb7",
+		hashXXHash:  "44bc2cf5ad770999",
+		hashBLAKE2b: "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319",
+	}
+
+	if len(hashNames()) != len(expected) {
+		t.Error("unexpected algorithms", hashNames())
+	}
+
+	for name, sum := range expected {
+		if err := checkHash(name); err != nil {
+			t.Error(err)
+		}
+
+		h := newHash(context.WithValue(context.Background(), "hash", name))
+		h.Write([]byte("abc"))
+		if actual := hashString(h); actual != sum {
+			t.Error(name, "expected", sum, "got", actual)
+		}
+	}
+
+	if err := checkHash("md4"); err == nil {
+		t.Error("expected error on unknown algorithm")
+	}
+
+	h := newHash(context.Background())
+	h.Write([]byte("abc"))
+	if hashString(h) != expected[hashMD5] {
+		t.Error("expected md5 by default")
+	}
+}
+
+func BenchmarkHashAlgorithms(b *testing.B) {
+	buf := make([]byte, sizeFormat.MB)
+	for _, name := range hashNames() {
+		b.Run(name, func(b *testing.B) {
+			h := newHash(context.WithValue(context.Background(), "hash", name))
+			b.SetBytes(int64(len(buf)))
+			for i := 0; i < b.N; i++ {
+				h.Write(buf)
+			}
+		})
+	}
+}
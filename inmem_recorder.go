@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 )
 
 type (
@@ -12,69 +13,138 @@ type (
 		marked bool
 	}
 
-	//InMemRecorder holding records in memory
+	//InMemRecorder holding records in memory. safe for concurrent use
 	InMemRecorder struct {
-		filesMap map[string]*inMemFile
+		// the records by path
+		files map[string]*inMemFile
+		// the same records by hash: files with equal content share one
+		hashes map[string][]*inMemFile
+		lock   sync.RWMutex
 	}
 )
 
 //NewInMemRecorder constructor
 func NewInMemRecorder() *InMemRecorder {
 	return &InMemRecorder{
-		filesMap: make(map[string]*inMemFile),
+		files:  make(map[string]*inMemFile),
+		hashes: make(map[string][]*inMemFile),
 	}
 }
 
-func (rec InMemRecorder) RecordFile(file *TempFile) error {
+func (rec *InMemRecorder) RecordFile(file *TempFile) error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
 	if file == nil {
 		return errors.New("temp file can't be null")
 	}
 
-	if value, exist := rec.filesMap[file.hash]; exist {
-		fmt.Fprintln(os.Stdout, "overwriting", file.hash, value.file.path, "->", file.path)
+	if value, exist := rec.files[file.path]; exist {
+		fmt.Fprintln(os.Stdout, "overwriting", file.path, value.file.hash, "->", file.hash)
+		sameHash := rec.hashes[value.file.hash]
+		for i, other := range sameHash {
+			if other == value {
+				rec.hashes[value.file.hash] = append(sameHash[:i], sameHash[i+1:]...)
+				break
+			}
+		}
 	}
 
-	rec.filesMap[file.hash] = &inMemFile{
+	record := &inMemFile{
 		file:   file,
 		marked: false,
 	}
+	rec.files[file.path] = record
+	rec.hashes[file.hash] = append(rec.hashes[file.hash], record)
 
 	return nil
 }
 
-func (rec InMemRecorder) VerifyFileExits(file *TempFile) (bool, error) {
+func (rec *InMemRecorder) VerifyFileExits(file *TempFile) (bool, error) {
+	rec.lock.RLock()
+	defer rec.lock.RUnlock()
+
 	if file == nil {
 		return false, errors.New("temp file can't be null")
 	}
 
-	_, exists := rec.filesMap[file.hash]
-	return exists, nil
+	return len(rec.hashes[file.hash]) > 0, nil
 }
 
-func (rec InMemRecorder) MarkFileExits(file *TempFile) (bool, error) {
+func (rec *InMemRecorder) MarkFileExits(file *TempFile) (bool, error) {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
 	if file == nil {
 		return false, errors.New("temp file can't be null")
 	}
 
-	var err error = nil
-	val, ok := rec.filesMap[file.hash]
-	if ok {
-		if val.marked {
-			fmt.Println("WARN", file.hash, "has already been marked")
+	sameHash := rec.hashes[file.hash]
+	if len(sameHash) == 0 {
+		return false, fmt.Errorf("%s does not exist", file.hash)
+	}
+
+	// files with equal content share a hash: mark one of them per call
+	for _, val := range sameHash {
+		if !val.marked {
+			val.marked = true
+			return true, nil
 		}
+	}
+
+	fmt.Println("WARN", file.hash, "has already been marked")
+	return true, nil
+}
+
+//FindFileByPath implements IFileRecorder
+func (rec *InMemRecorder) FindFileByPath(path string) (*TempFile, error) {
+	rec.lock.RLock()
+	defer rec.lock.RUnlock()
+
+	if val, ok := rec.files[path]; ok {
+		return val.file, nil
+	}
+
+	return nil, nil
+}
+
+//MarkPathExists implements IFileRecorder
+func (rec *InMemRecorder) MarkPathExists(path string) (bool, error) {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	val, ok := rec.files[path]
+	if !ok {
+		return false, fmt.Errorf("%s does not exist", path)
+	}
 
-		val.marked = true
-	} else {
-		err = fmt.Errorf("%s does not exist", file.hash)
+	if val.marked {
+		fmt.Println("WARN", path, "has already been marked")
 	}
+	val.marked = true
 
-	return ok, err
+	return true, nil
+}
+
+//UnmarkAll resets verification marks, so records can be verified again
+func (rec *InMemRecorder) UnmarkAll() error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	for _, tmp := range rec.files {
+		tmp.marked = false
+	}
+
+	return nil
 }
 
 //FilesNotCheckedYet implements IFileRecorder
-func (rec InMemRecorder) FilesNotCheckedYet() ([]*TempFile, error) {
+func (rec *InMemRecorder) FilesNotCheckedYet() ([]*TempFile, error) {
+	rec.lock.RLock()
+	defer rec.lock.RUnlock()
+
 	result := make([]*TempFile, 0)
-	for _, tmp := range rec.filesMap {
+	for _, tmp := range rec.files {
 		if !tmp.marked {
 			result = append(result, tmp.file)
 		}
@@ -84,25 +154,25 @@ func (rec InMemRecorder) FilesNotCheckedYet() ([]*TempFile, error) {
 }
 
 //GetTotalUnmarked implements IFileRecorder
-func (rec InMemRecorder) GetTotalUnmarked() (int64, error) {
-	res := int64(0)
-	for _, tmp := range rec.filesMap {
-		if !tmp.marked {
-			res += tmp.file.size
-		}
-	}
-
-	return res, nil
+func (rec *InMemRecorder) GetTotalUnmarked() (int64, error) {
+	return rec.sumSize(false), nil
 }
 
 //GetTotalMarked implements IFileRecorder
-func (rec InMemRecorder) GetTotalMarked() (int64, error) {
+func (rec *InMemRecorder) GetTotalMarked() (int64, error) {
+	return rec.sumSize(true), nil
+}
+
+func (rec *InMemRecorder) sumSize(marked bool) int64 {
+	rec.lock.RLock()
+	defer rec.lock.RUnlock()
+
 	res := int64(0)
-	for _, tmp := range rec.filesMap {
-		if tmp.marked {
+	for _, tmp := range rec.files {
+		if tmp.marked == marked {
 			res += tmp.file.size
 		}
 	}
 
-	return res, nil
+	return res
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -16,36 +18,39 @@ func TestRecordFile(t *testing.T) {
 	rec := NewInMemRecorder()
 
 	f1 := TempFile{
+		path: "a",
 		hash: "hash1",
 	}
 
 	rec.RecordFile(&f1)
 
-	if len(rec.filesMap) != 1 {
-		t.Error("expected internal map len to be 1, instead, saw", len(rec.filesMap))
+	if len(rec.files) != 1 {
+		t.Error("expected internal map len to be 1, instead, saw", len(rec.files))
 	}
 
-	if _, ok := rec.filesMap[f1.hash]; !ok {
+	if _, ok := rec.files[f1.path]; !ok {
 		t.Error("expected value to be present in the map", f1)
 	}
 
 	rec.RecordFile(&f1)
 
-	if len(rec.filesMap) != 1 {
-		t.Error("expected internal map len to be 1, instead, saw", len(rec.filesMap))
+	if len(rec.files) != 1 || len(rec.hashes[f1.hash]) != 1 {
+		t.Error("expected internal map len to be 1, instead, saw", len(rec.files), len(rec.hashes[f1.hash]))
 	}
 
+	// the same content at another path is another file
 	f2 := TempFile{
-		hash: "hash2",
+		path: "b",
+		hash: "hash1",
 	}
 
 	rec.RecordFile(&f2)
 
-	if len(rec.filesMap) != 2 {
-		t.Error("expected internal map len to be 2, instead, saw", len(rec.filesMap))
+	if len(rec.files) != 2 {
+		t.Error("expected internal map len to be 2, instead, saw", len(rec.files))
 	}
 
-	if _, ok := rec.filesMap[f2.hash]; !ok {
+	if _, ok := rec.files[f2.path]; !ok {
 		t.Error("expected value to be present in the map", f2)
 	}
 }
@@ -54,9 +59,11 @@ func TestVerifyFileExits(t *testing.T) {
 	rec := NewInMemRecorder()
 
 	f1 := TempFile{
+		path: "a",
 		hash: "hash1",
 	}
 	f2 := TempFile{
+		path: "b",
 		hash: "hash2",
 	}
 
@@ -76,6 +83,7 @@ func TestVerifyFileExits(t *testing.T) {
 	}
 
 	f3 := TempFile{
+		path: "c",
 		hash: "hash3",
 	}
 
@@ -88,9 +96,11 @@ func TestMarkFileExits(t *testing.T) {
 	rec := NewInMemRecorder()
 
 	f1 := TempFile{
+		path: "a",
 		hash: "hash1",
 	}
 	f2 := TempFile{
+		path: "b",
 		hash: "hash2",
 	}
 
@@ -113,9 +123,11 @@ func TestFilesNotCheckedYet(t *testing.T) {
 	rec := NewInMemRecorder()
 
 	f1 := TempFile{
+		path: "a",
 		hash: "hash1",
 	}
 	f2 := TempFile{
+		path: "b",
 		hash: "hash2",
 	}
 
@@ -133,3 +145,89 @@ func TestFilesNotCheckedYet(t *testing.T) {
 	}
 
 }
+
+func TestFilesNotCheckedYetSameHash(t *testing.T) {
+	rec := NewInMemRecorder()
+
+	f1 := TempFile{path: "a", size: 2, hash: "hash1"}
+	f2 := TempFile{path: "b", size: 3, hash: "hash1"}
+	rec.RecordFile(&f1)
+	rec.RecordFile(&f2)
+	rec.MarkPathExists("b")
+
+	notChecked, err := rec.FilesNotCheckedYet()
+	if err != nil || len(notChecked) != 1 || notChecked[0] != &f1 {
+		t.Error("expected the file with the same content to be left", err, notChecked)
+	}
+	if unmarked, err := rec.GetTotalUnmarked(); unmarked != 2 || err != nil {
+		t.Error("expected 2 unmarked bytes, got", unmarked, err)
+	}
+
+	// marked by content, one at a time
+	rec.MarkFileExits(&f1)
+	if marked, err := rec.GetTotalMarked(); marked != 5 || err != nil {
+		t.Error("expected 5 marked bytes, got", marked, err)
+	}
+}
+
+func TestFindFileByPath(t *testing.T) {
+	rec := NewInMemRecorder()
+
+	f1 := TempFile{path: "a", hash: "hash1"}
+	rec.RecordFile(&f1)
+
+	if found, err := rec.FindFileByPath("a"); found != &f1 || err != nil {
+		t.Error("unexpected", found, err)
+	}
+
+	if found, err := rec.FindFileByPath("b"); found != nil || err != nil {
+		t.Error("unexpected", found, err)
+	}
+}
+
+func TestMarkPathExists(t *testing.T) {
+	rec := NewInMemRecorder()
+
+	f1 := TempFile{path: "a", hash: "hash1"}
+	f2 := TempFile{path: "b", hash: "hash2"}
+	rec.RecordFile(&f1)
+	rec.RecordFile(&f2)
+
+	if marked, err := rec.MarkPathExists("a"); !marked || err != nil {
+		t.Error("unexpected", marked, err)
+	}
+
+	if marked, err := rec.MarkPathExists("c"); marked || err == nil {
+		t.Error("unexpected", marked, err)
+	}
+
+	notChecked, err := rec.FilesNotCheckedYet()
+	if err != nil || len(notChecked) != 1 || notChecked[0] != &f2 {
+		t.Error("unexpected", err, notChecked)
+	}
+}
+
+func TestInMemRecorderConcurrent(t *testing.T) {
+	rec := NewInMemRecorder()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			rec.RecordFile(&TempFile{path: fmt.Sprint("file_", i), hash: fmt.Sprint("hash", i), size: 1})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			rec.FindFileByPath(fmt.Sprint("file_", i))
+			rec.GetTotalUnmarked()
+		}
+	}()
+	wg.Wait()
+
+	if total, err := rec.GetTotalUnmarked(); total != 100 || err != nil {
+		t.Error("unexpected", total, err)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+//the number of intervals throughput over time is reported in
+const throughputIntervals = 20
+
+type (
+	ioSample struct {
+		size     int64
+		duration time.Duration
+		end      time.Time
+	}
+
+	//IOStats collects the duration of every file written or read, to report throughput
+	IOStats struct {
+		name string
+		// file size ranges the throughput is reported for, smallest first
+		classes []tempFileSizeConstraint
+		lock    sync.Mutex
+		samples []ioSample
+	}
+
+	sizeClass struct {
+		name        string
+		files       int
+		bytes       int64
+		busyTime    time.Duration
+		first, last time.Time
+	}
+
+	throughputInterval struct {
+		offset time.Duration
+		length time.Duration
+		bytes  int64
+	}
+
+	//IOSummary is the throughput of an I/O phase, as collected by IOStats
+	IOSummary struct {
+		Total   *classSummary    `json:"total"`
+		Classes []*classSummary  `json:"size_classes"`
+		PerFile map[string]int64 `json:"per_file_bytes_per_second"`
+		// time taken by a file, including any fsync
+		Latency  map[string]float64 `json:"per_file_latency_seconds"`
+		OverTime []intervalSummary  `json:"over_time"`
+	}
+
+	classSummary struct {
+		Name    string  `json:"name"`
+		Files   int     `json:"files"`
+		Bytes   int64   `json:"bytes"`
+		Seconds float64 `json:"seconds"`
+		// over the wall clock time
+		BytesPerSecond int64 `json:"bytes_per_second"`
+		// over the time spent on each file
+		StreamBytesPerSecond int64 `json:"stream_bytes_per_second"`
+	}
+
+	intervalSummary struct {
+		OffsetSeconds  float64 `json:"offset_seconds"`
+		BytesPerSecond int64   `json:"bytes_per_second"`
+	}
+)
+
+var reportedPercentiles = []struct {
+	name    string
+	percent int
+}{{"min", 0}, {"p10", 10}, {"p50", 50}, {"p90", 90}, {"p99", 99}, {"max", 100}}
+
+//NewIOStats constructor. name is the I/O phase, e.g. write. The throughput is reported per size range of sizes,
+//the default profile if nil
+func NewIOStats(name string, sizes *sizeProfile) *IOStats {
+	if sizes == nil {
+		sizes = sizePresets[sizesDefault]()
+	}
+
+	return &IOStats{
+		name:    name,
+		classes: sizes.statClasses(),
+		samples: make([]ioSample, 0),
+	}
+}
+
+//GetIOStats returns the IOStats stored in context at key, or nil
+func GetIOStats(ctx context.Context, key interface{}) *IOStats {
+	stats, _ := ctx.Value(key).(*IOStats)
+	return stats
+}
+
+//Record adds a file of size that took duration to process. No-op on nil stats
+func (stats *IOStats) Record(size int64, duration time.Duration) {
+	if stats == nil {
+		return
+	}
+
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.samples = append(stats.samples, ioSample{size: size, duration: duration, end: time.Now()})
+}
+
+func (sample *ioSample) start() time.Time {
+	return sample.end.Add(-sample.duration)
+}
+
+func bytesPerSecond(size int64, duration time.Duration) int64 {
+	if duration <= 0 {
+		return 0
+	}
+
+	return int64(float64(size) / duration.Seconds())
+}
+
+//fileSizeClass tells which of the size ranges of stats a file of size belongs to: the largest one it reaches.
+//Files smaller than all of them, e.g. cut short to fill the volume, go to the smallest
+func (stats *IOStats) fileSizeClass(size int64) int {
+	class := 0
+	for i, sizeRange := range stats.classes {
+		if size >= sizeRange.min {
+			class = i
+		}
+	}
+
+	return class
+}
+
+//sizeClassName names a size range by its bounds
+func sizeClassName(sizeRange tempFileSizeConstraint) string {
+	if sizeRange.min == sizeRange.max {
+		return sizeFormat.ToString(sizeRange.min)
+	}
+
+	return sizeFormat.ToString(sizeRange.min) + "-" + sizeFormat.ToString(sizeRange.max)
+}
+
+//Summary calculates aggregate, per size class, per file and over time throughput. nil if nothing was recorded
+func (stats *IOStats) Summary() *IOSummary {
+	if stats == nil {
+		return nil
+	}
+
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	if len(stats.samples) == 0 {
+		return nil
+	}
+
+	classes := make([]*sizeClass, len(stats.classes))
+	for i, sizeRange := range stats.classes {
+		classes[i] = &sizeClass{name: sizeClassName(sizeRange)}
+	}
+	total := sizeClass{name: "total"}
+	rates := make([]int64, len(stats.samples))
+	latencies := make([]time.Duration, len(stats.samples))
+	for i := range stats.samples {
+		sample := &stats.samples[i]
+		rates[i] = bytesPerSecond(sample.size, sample.duration)
+		latencies[i] = sample.duration
+		total.add(sample)
+		classes[stats.fileSizeClass(sample.size)].add(sample)
+	}
+
+	summary := &IOSummary{
+		Total:    total.summary(),
+		Classes:  make([]*classSummary, 0, len(classes)),
+		PerFile:  make(map[string]int64, len(reportedPercentiles)),
+		Latency:  make(map[string]float64, len(reportedPercentiles)),
+		OverTime: make([]intervalSummary, 0, throughputIntervals),
+	}
+	for _, class := range classes {
+		if class.files > 0 {
+			summary.Classes = append(summary.Classes, class.summary())
+		}
+	}
+
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	for _, p := range reportedPercentiles {
+		summary.PerFile[p.name] = rates[(len(rates)-1)*p.percent/100]
+		summary.Latency[p.name] = latencies[(len(latencies)-1)*p.percent/100].Seconds()
+	}
+
+	for _, interval := range stats.overTime(total.first, total.last) {
+		summary.OverTime = append(summary.OverTime, intervalSummary{
+			OffsetSeconds:  interval.offset.Seconds(),
+			BytesPerSecond: bytesPerSecond(interval.bytes, interval.length),
+		})
+	}
+
+	return summary
+}
+
+//Print writes the summary in a human readable form
+func (stats *IOStats) Print(w io.Writer) {
+	if stats == nil {
+		return
+	}
+
+	stats.Summary().Print(w, stats.name)
+}
+
+//Print writes the summary of the I/O phase name in a human readable form
+func (summary *IOSummary) Print(w io.Writer, name string) {
+	if summary == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "%s throughput:\n", name)
+	width := 0
+	for _, class := range append(summary.Classes, summary.Total) {
+		if len(class.Name) > width {
+			width = len(class.Name)
+		}
+	}
+	for _, class := range append(summary.Classes, summary.Total) {
+		// files are processed concurrently: aggregate over the wall clock time
+		fmt.Fprintf(w, "  %-*s %6d files %10s in %v: %s/s aggregate, %s/s per stream\n",
+			width, class.Name, class.Files, sizeFormat.ToString(class.Bytes), secondsDuration(class.Seconds).Round(time.Millisecond),
+			sizeFormat.ToString(class.BytesPerSecond), sizeFormat.ToString(class.StreamBytesPerSecond))
+	}
+
+	perFile := make([]string, len(reportedPercentiles))
+	latency := make([]string, len(reportedPercentiles))
+	for i, p := range reportedPercentiles {
+		perFile[i] = fmt.Sprintf("%s %s/s", p.name, sizeFormat.ToString(summary.PerFile[p.name]))
+		latency[i] = fmt.Sprintf("%s %v", p.name, secondsDuration(summary.Latency[p.name]).Round(time.Millisecond))
+	}
+	fmt.Fprintln(w, "  per file:", strings.Join(perFile, ", "))
+	fmt.Fprintln(w, "  latency per file:", strings.Join(latency, ", "))
+
+	fmt.Fprintln(w, "  over time:")
+	for _, interval := range summary.OverTime {
+		fmt.Fprintf(w, "    +%-10v %s/s\n", secondsDuration(interval.OffsetSeconds), sizeFormat.ToString(interval.BytesPerSecond))
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func (class *sizeClass) summary() *classSummary {
+	wallTime := class.last.Sub(class.first)
+	return &classSummary{
+		Name:                 class.name,
+		Files:                class.files,
+		Bytes:                class.bytes,
+		Seconds:              wallTime.Seconds(),
+		BytesPerSecond:       bytesPerSecond(class.bytes, wallTime),
+		StreamBytesPerSecond: bytesPerSecond(class.bytes, class.busyTime),
+	}
+}
+
+func (class *sizeClass) add(sample *ioSample) {
+	class.files++
+	class.bytes += sample.size
+	class.busyTime += sample.duration
+	if class.first.IsZero() || sample.start().Before(class.first) {
+		class.first = sample.start()
+	}
+	if sample.end.After(class.last) {
+		class.last = sample.end
+	}
+}
+
+//overTime splits [first, last] into intervals and spreads the bytes of every file evenly over the time it took
+func (stats *IOStats) overTime(first, last time.Time) []throughputInterval {
+	length := last.Sub(first) / throughputIntervals
+	if length < time.Second {
+		length = time.Second
+	}
+	length = length.Round(time.Second)
+
+	num := int((last.Sub(first) + length - 1) / length)
+	if num == 0 {
+		num = 1
+	}
+	intervals := make([]throughputInterval, num)
+	for i := range intervals {
+		intervals[i] = throughputInterval{offset: time.Duration(i) * length, length: length}
+	}
+
+	for _, sample := range stats.samples {
+		from := sample.start().Sub(first)
+		to := sample.end.Sub(first)
+		if to <= from {
+			i := int(from / length)
+			if i >= num {
+				i = num - 1
+			}
+			intervals[i].bytes += sample.size
+			continue
+		}
+
+		for i := int(from / length); i < num && intervals[i].offset < to; i++ {
+			overlapFrom, overlapTo := intervals[i].offset, intervals[i].offset+length
+			if from > overlapFrom {
+				overlapFrom = from
+			}
+			if to < overlapTo {
+				overlapTo = to
+			}
+			intervals[i].bytes += int64(float64(sample.size) * float64(overlapTo-overlapFrom) / float64(to-from))
+		}
+	}
+
+	// the last interval is usually partial
+	intervals[num-1].length = last.Sub(first) - intervals[num-1].offset
+	return intervals
+}
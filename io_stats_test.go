@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+func TestIOStatsRecord(t *testing.T) {
+	var nilStats *IOStats
+	nilStats.Record(1, time.Second)
+	nilStats.Print(nil)
+
+	if GetIOStats(context.Background(), "write_stats") != nil {
+		t.Error("expected nil stats from empty context")
+	}
+
+	stats := NewIOStats("write", nil)
+	ctx := context.WithValue(context.Background(), "write_stats", stats)
+	GetIOStats(ctx, "write_stats").Record(sizeFormat.MB, time.Second)
+	GetIOStats(ctx, "write_stats").Record(sizeFormat.GB, 2*time.Second)
+
+	if len(stats.samples) != 2 {
+		t.Error("expected 2 samples, got", len(stats.samples))
+	}
+
+	var out bytes.Buffer
+	stats.Print(&out)
+	for _, expected := range []string{"write throughput", sizeClassName(smallFileSizeConstraint), sizeClassName(medFileSizeConstraint), "per file", "latency per file: min 1s", "over time"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Error("expected", expected, "in", out.String())
+		}
+	}
+}
+
+func TestIOStatsSizeClasses(t *testing.T) {
+	sizes, err := parseSizeProfile("histogram=1KB-64KB:5,1MB-1MB:1,64KB-1MB:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := NewIOStats("write", sizes)
+
+	for size, expected := range map[int64]int{
+		100:                0,
+		2 * sizeFormat.KB:  0,
+		64 * sizeFormat.KB: 1,
+		sizeFormat.MB:      2,
+		sizeFormat.GB:      2,
+	} {
+		if class := stats.fileSizeClass(size); class != expected {
+			t.Error("expected", size, "in class", expected, "got", class)
+		}
+	}
+
+	stats.Record(sizeFormat.MB, time.Second)
+	summary := stats.Summary()
+	if len(summary.Classes) != 1 || summary.Classes[0].Name != sizeFormat.ToString(sizeFormat.MB) {
+		t.Error("expected the 1MB class only, got", summary.Classes)
+	}
+}
+
+func TestIOStatsOverTime(t *testing.T) {
+	stats := NewIOStats("read", nil)
+	first := time.Now()
+	stats.samples = append(stats.samples,
+		ioSample{size: 100, duration: 10 * time.Second, end: first.Add(10 * time.Second)},
+		ioSample{size: 50, duration: 5 * time.Second, end: first.Add(40 * time.Second)},
+		ioSample{size: 7, duration: 0, end: first.Add(40 * time.Second)},
+	)
+
+	intervals := stats.overTime(first, first.Add(40*time.Second))
+	if len(intervals) != 20 {
+		t.Fatal("expected 20 intervals, got", len(intervals))
+	}
+
+	total := int64(0)
+	for _, interval := range intervals {
+		total += interval.bytes
+	}
+	if total != 157 {
+		t.Error("expected all 157 bytes to be spread over time, got", total)
+	}
+
+	if intervals[0].bytes != 20 || intervals[10].bytes != 0 {
+		t.Error("unexpected distribution", intervals)
+	}
+}
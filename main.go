@@ -3,13 +3,16 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"runtime"
+	"os/signal"
 	"runtime/pprof"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	sizeFormat "github.com/rdev02/size-format"
 )
@@ -17,6 +20,21 @@ import (
 const (
 	verifyInMem    = "mem"
 	verifyInSQLite = "sqlite"
+	verifySeeded   = "seed"
+)
+
+//process exit codes
+const (
+	exitSuccess = 0
+	// some files read back with content other than written
+	exitMismatch = 1
+	// same as the flag package uses for bad flags
+	exitBadArgs = 2
+	// some recorded files were not found
+	exitMissing = 3
+	// the run could not complete because of an error
+	exitIOError   = 4
+	exitCancelled = 5
 )
 
 type (
@@ -25,10 +43,42 @@ type (
 		size           string
 		verify         string
 		generate       string
+		capacity       string
+		metadata       string
+		clean          string
+		metadataSize   string
+		cleanup        string
+		onlyRecorded   string
+		byName         string
+		report         string
 		cpuprofile     string
 		memprofile     string
 		waitBeforeExit string
+		dbPath         string
+		manifest       string
+		resume         string
+		partial        string
+		onError        string
+		cache          string
+		fsync          string
+		dirSync        string
+		hash           string
+		sizes          string
+		charset        string
+		depth          int
+		fanOut         int
+		filesPerDir    int
+		nameLen        int
 		maxParallel    int
+		seed           int64
+		files          int64
+		// the subcommand, empty for the flags only command line
+		command string
+		// generate without verifying, even if recording
+		skipVerify bool
+		// burn-in: passes of generate, verify and clean, for up to duration, 0 unlimited
+		passes   int
+		duration time.Duration
 	}
 
 	//TempFile connects main/generator/processor and recorder
@@ -36,6 +86,8 @@ type (
 		path string
 		size int64
 		hash string
+		// checksums of every checksumBlockSize block, to localize corruption
+		blocks []uint32
 	}
 
 	//IFileRecorder defines methods necessary to record a file
@@ -43,6 +95,9 @@ type (
 		RecordFile(file *TempFile) error
 		MarkFileExits(file *TempFile) (bool, error)
 		VerifyFileExits(file *TempFile) (bool, error)
+		// nil if nothing was recorded at path
+		FindFileByPath(path string) (*TempFile, error)
+		MarkPathExists(path string) (bool, error)
 		FilesNotCheckedYet() ([]*TempFile, error)
 		GetTotalUnmarked() (int64, error)
 		GetTotalMarked() (int64, error)
@@ -59,7 +114,29 @@ func defaultFlags() *cmdFlags {
 		size:           "1GB",
 		verify:         verifyInMem,
 		generate:       "y",
+		capacity:       "n",
+		metadata:       "n",
+		clean:          "n",
+		cleanup:        cleanupNever,
+		onlyRecorded:   "n",
+		byName:         "n",
+		passes:         1,
+		metadataSize:   "4KB",
+		files:          1000000,
 		waitBeforeExit: "n",
+		dbPath:         "disktest.db",
+		resume:         "n",
+		partial:        partialRemove,
+		onError:        "stop",
+		cache:          cacheUse,
+		fsync:          syncNone,
+		dirSync:        "n",
+		hash:           hashMD5,
+		sizes:          sizesDefault,
+		charset:        charsetASCII,
+		depth:          -1,
+		fanOut:         numSubfolders,
+		filesPerDir:    numFilesPerFolder,
 		maxParallel:    0,
 	}
 
@@ -67,24 +144,27 @@ func defaultFlags() *cmdFlags {
 }
 
 func main() {
-	cmdFlags := defaultFlags()
-	flag.StringVar(&cmdFlags.size, "size", cmdFlags.size, "the total size of files to generate. no effect if used without the --generate flag")
-	flag.StringVar(&cmdFlags.generate, "generate", cmdFlags.generate, "generate files at the location specified: y/n")
-	flag.StringVar(&cmdFlags.verify, "verify", cmdFlags.verify, fmt.Sprintf("verify results via %s/%s/none", verifyInMem, verifyInSQLite))
-	flag.StringVar(&cmdFlags.cpuprofile, "cpuprofile", "", "write cpu profile to file")
-	flag.StringVar(&cmdFlags.memprofile, "memprofile", "", "write mem profile to file")
-	flag.StringVar(&cmdFlags.waitBeforeExit, "waitbeforeexit", cmdFlags.waitBeforeExit, "wait before exiting y/n")
-	flag.IntVar(&cmdFlags.maxParallel, "maxparallel", cmdFlags.maxParallel, "max parallel processing streams. default(0) = CPU cores - 1")
-
-	flag.Parse()
-
-	sizeBytes, err := sizeFormat.ToNum(&cmdFlags.size)
-	if err != nil || sizeBytes <= 0 {
-		fmt.Fprintln(os.Stderr, "Invaid size", sizeBytes)
-		fmt.Fprintln(os.Stderr, err)
-		return
+	if exitCode := runCommand(os.Args[1:]); exitCode != exitSuccess {
+		os.Exit(exitCode)
+	}
+}
+
+//run runs what cmdFlags select at rootPath, with the values of flags as the parameters of the run report,
+//once or as a burn-in of several passes. returns the exit code
+func run(cmdFlags *cmdFlags, flags *flag.FlagSet, rootPath string) int {
+	if cmdFlags.passes != 1 || cmdFlags.duration != 0 {
+		return burnIn(cmdFlags, flags, rootPath)
+	}
+
+	runReport, exitCode := runPass(cmdFlags, flags, rootPath)
+	if runReport != nil {
+		done(cmdFlags)
 	}
+	return exitCode
+}
 
+//runPass runs what cmdFlags select at rootPath once. returns the report of the run, nil if it did not start, and the exit code
+func runPass(cmdFlags *cmdFlags, flags *flag.FlagSet, rootPath string) (runReport *RunReport, exitCode int) {
 	// cpu profiling
 	if cmdFlags.cpuprofile != "" {
 		f, err := os.Create(cmdFlags.cpuprofile)
@@ -106,96 +186,516 @@ func main() {
 		defer f.Close()
 	}
 
-	if len(flag.Args()) != 1 {
-		fmt.Println("path not provided. syntax: disktest [opts] path")
-		flag.PrintDefaults()
+	if cmdFlags.maxParallel < 0 {
+		fmt.Fprintln(os.Stderr, "-maxparallel flag must be >= 0")
+		exitCode = exitBadArgs
+		return
+	}
+
+	if len(rootPath) == 0 {
+		rootPath = cmdFlags.rootPath
+	}
+	capacityCheck := strings.Compare(cmdFlags.capacity, "y") == 0
+	metadataCheck := strings.Compare(cmdFlags.metadata, "y") == 0 && !capacityCheck
+	cleaning := strings.Compare(cmdFlags.clean, "y") == 0 && !capacityCheck && !metadataCheck
+	generating := strings.Compare(cmdFlags.generate, "y") == 0 && !capacityCheck && !metadataCheck && !cleaning
+
+	var sizeBytes int64
+	var err error
+	if generating {
+		sizeBytes, err = parseSize(cmdFlags.size, rootPath)
+		if err != nil || sizeBytes <= 0 {
+			fmt.Fprintln(os.Stderr, "Invaid size", sizeBytes)
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = exitBadArgs
+			return
+		}
+	}
+
+	resuming := generating && strings.Compare(cmdFlags.resume, "y") == 0
+	if resuming && len(cmdFlags.manifest) == 0 {
+		fmt.Fprintln(os.Stderr, "-resume requires -manifest")
+		exitCode = exitBadArgs
 		return
 	}
 
-	if cmdFlags.maxParallel < 0 {
-		panic("-maxparallel flag must be >= 0")
+	if cmdFlags.cleanup != cleanupAlways && cmdFlags.cleanup != cleanupOnSuccess && cmdFlags.cleanup != cleanupNever {
+		fmt.Fprintln(os.Stderr, "unknown -cleanup", cmdFlags.cleanup)
+		exitCode = exitBadArgs
+		return
+	}
+
+	if cmdFlags.partial != partialRemove && cmdFlags.partial != partialMark {
+		fmt.Fprintln(os.Stderr, "unknown -partial", cmdFlags.partial)
+		exitCode = exitBadArgs
+		return
+	}
+
+	switch {
+	case cmdFlags.cache != cacheUse && cmdFlags.cache != cacheDrop && cmdFlags.cache != cacheBypass:
+		fmt.Fprintln(os.Stderr, "unknown -cache", cmdFlags.cache)
+		exitCode = exitBadArgs
+		return
+	case cmdFlags.cache != cacheUse && !cacheControlSupported:
+		fmt.Fprintln(os.Stderr, "-cache", cmdFlags.cache, "is not supported on this platform")
+		exitCode = exitBadArgs
+		return
+	}
+
+	durability, err := parseSyncPolicy(cmdFlags.fsync, strings.Compare(cmdFlags.dirSync, "y") == 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = exitBadArgs
+		return
+	}
+
+	if err := checkHash(cmdFlags.hash); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = exitBadArgs
+		return
+	}
+
+	onError, err := parseErrorPolicy(cmdFlags.onError)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = exitBadArgs
+		return
+	}
+
+	sizes, err := parseSizeProfile(cmdFlags.sizes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = exitBadArgs
+		return
+	}
+
+	tree, err := newTreeShape(cmdFlags.depth, cmdFlags.fanOut, cmdFlags.filesPerDir, cmdFlags.nameLen, cmdFlags.charset)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = exitBadArgs
+		return
+	}
+
+	var metadataSize int64
+	if metadataCheck && cmdFlags.metadataSize != "0" {
+		metadataSize, err = toNum(cmdFlags.metadataSize)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid -metadatasize", cmdFlags.metadataSize, err)
+			exitCode = exitBadArgs
+			return
+		}
+	}
+
+	if capacityCheck || metadataCheck || cleaning {
+		// capacity and metadata checks record and verify on their own, clean neither
+		cmdFlags.skipVerify = true
+		if !cleaning || cmdFlags.verify != verifyInSQLite {
+			cmdFlags.verify = ""
+		}
 	}
 
 	var recordingStrategy *IFileRecorder
+	var sqliteRec *SqliteRecorder
 	switch cmdFlags.verify {
 	case verifyInMem:
 		rec := IFileRecorder(NewInMemRecorder())
 		recordingStrategy = &rec
 		fmt.Println("using in-memory recorder")
 	case verifyInSQLite:
-		rec := IFileRecorder(NewSqlLiteRecorder())
+		sqliteRec, err = NewSqlLiteRecorder(cmdFlags.dbPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not open sqlite recorder:", err)
+			exitCode = exitIOError
+			return
+		}
+		defer sqliteRec.Close()
+
+		// a new generation starts from a clean slate, otherwise re-verify what's already recorded
+		if generating {
+			err = sqliteRec.Truncate()
+		} else {
+			err = sqliteRec.UnmarkAll()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not reset sqlite recorder:", err)
+			exitCode = exitIOError
+			return
+		}
+
+		if !generating {
+			recordedHash, err := sqliteRec.GetMeta(sqliteMetaHash)
+			if err == nil {
+				err = adoptRecordedHash(cmdFlags, recordedHash, "sqlite recorder")
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not use sqlite recorder:", err)
+				exitCode = exitIOError
+				return
+			}
+		}
+
+		rec := IFileRecorder(sqliteRec)
 		recordingStrategy = &rec
-		fmt.Println("using SqLite recorder")
+		fmt.Println("using SqLite recorder at", cmdFlags.dbPath)
+	case verifySeeded:
+		fmt.Println("verifying against the seeded content")
 	default:
-		fmt.Println("no recording")
+		if !capacityCheck && !metadataCheck && !cleaning {
+			fmt.Println("no recording")
+		}
+	}
+	verifying := (recordingStrategy != nil || strings.Compare(cmdFlags.verify, verifySeeded) == 0) && !cmdFlags.skipVerify
+	verifyRecorder := recordingStrategy
+	onlyRecorded := verifying && strings.Compare(cmdFlags.onlyRecorded, "y") == 0
+	if onlyRecorded && verifyRecorder == nil && len(cmdFlags.manifest) == 0 {
+		fmt.Fprintln(os.Stderr, "-onlyrecorded needs a recorder or a -manifest to tell the recorded files")
+		exitCode = exitBadArgs
+		return
+	}
+
+	// the paths generated by the run being resumed
+	var recordedPaths map[string]bool
+	if len(cmdFlags.manifest) > 0 && (generating || verifying) {
+		var inner IFileRecorder
+		if recordingStrategy != nil {
+			inner = *recordingStrategy
+		} else if resuming {
+			// to tell the files already generated
+			inner = NewInMemRecorder()
+		}
+
+		var fresh *manifestHeader
+		if generating && !resuming {
+			fresh = &manifestHeader{Seed: cmdFlags.seed, Size: sizeBytes, Hash: cmdFlags.hash, Sizes: cmdFlags.sizes, Tree: &manifestTree{
+				Depth:       cmdFlags.depth,
+				FanOut:      cmdFlags.fanOut,
+				FilesPerDir: cmdFlags.filesPerDir,
+				NameLen:     cmdFlags.nameLen,
+				Charset:     cmdFlags.charset,
+			}}
+		}
+
+		manifestRec, err := NewManifestRecorder(cmdFlags.manifest, rootPath, inner, fresh)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not open manifest:", err)
+			exitCode = exitIOError
+			return
+		}
+		defer manifestRec.Close()
+
+		if cmdFlags.seed == 0 {
+			cmdFlags.seed = manifestRec.Header().Seed
+		}
+
+		if err := adoptRecordedHash(cmdFlags, manifestRec.Header().Hash, "manifest"); err != nil {
+			fmt.Fprintln(os.Stderr, "could not use manifest:", err)
+			exitCode = exitIOError
+			return
+		}
+
+		if resuming {
+			if total := manifestRec.Header().Size; total > 0 {
+				sizeBytes = total
+			}
+			// the rest is generated the way the interrupted run started
+			adoptRecordedLayout(cmdFlags, manifestRec.Header())
+			if sizes, err = parseSizeProfile(cmdFlags.sizes); err == nil {
+				tree, err = newTreeShape(cmdFlags.depth, cmdFlags.fanOut, cmdFlags.filesPerDir, cmdFlags.nameLen, cmdFlags.charset)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not resume with the manifest layout:", err)
+				exitCode = exitIOError
+				return
+			}
+			generated := manifestRec.Recorded()
+			fmt.Println("resuming:", sizeFormat.ToString(generated), "of", sizeFormat.ToString(sizeBytes), "already generated")
+			sizeBytes -= generated
+			if sizeBytes <= 0 {
+				fmt.Println("nothing left to generate")
+				generating = false
+			}
+
+			files, err := manifestRec.FilesNotCheckedYet()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not resume:", err)
+				exitCode = exitIOError
+				return
+			}
+			recordedPaths = make(map[string]bool, len(files))
+			for _, file := range files {
+				recordedPaths[file.path] = true
+			}
+		}
+
+		rec := IFileRecorder(manifestRec)
+		if verifyRecorder != nil {
+			verifyRecorder = &rec
+		}
+		recordingStrategy = &rec
+		fmt.Println("using manifest at", cmdFlags.manifest)
 	}
 
-	ctx, stopExecution := context.WithCancel(context.Background())
-	maxThreads := cmdFlags.maxParallel
-	if maxThreads == 0 {
-		maxThreads = runtime.NumCPU() - 1
-		if maxThreads == 0 {
-			maxThreads = 1
+	// the hash algorithm is settled, manifest included: record it along with the files
+	if sqliteRec != nil && (generating || resuming) {
+		if err := sqliteRec.SetMeta(sqliteMetaHash, cmdFlags.hash); err != nil {
+			fmt.Fprintln(os.Stderr, "could not write to sqlite recorder:", err)
+			exitCode = exitIOError
+			return
 		}
 	}
 
+	// signalled outlives the commands stopping on their own, so the cleanup after them can still be stopped
+	signalled, stopSignalled := context.WithCancel(context.Background())
+	ctx, stopExecution := context.WithCancel(signalled)
+	defer stopExecution()
+	maxThreads := maxParallel(cmdFlags.maxParallel)
+
+	// the first signal stops the run gracefully, the second one right away
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		sig, ok := <-signals
+		if !ok {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "received", sig, "- stopping: the files being written are cut short. repeat to exit immediately")
+		stopSignalled()
+
+		// closed once the run is over
+		if sig, ok = <-signals; !ok {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "received", sig, "- exiting immediately")
+		os.Exit(exitCancelled)
+	}()
+
 	ctx = context.WithValue(ctx, "max_parallel", maxThreads)
+	ctx = context.WithValue(ctx, "partial_files", cmdFlags.partial)
+	ctx = context.WithValue(ctx, "cache", cmdFlags.cache)
+	ctx = context.WithValue(ctx, "sync_policy", durability)
+	ctx = context.WithValue(ctx, "hash", cmdFlags.hash)
+	ctx = context.WithValue(ctx, "size_profile", sizes)
+	ctx = context.WithValue(ctx, "tree_shape", tree)
+	ctx = context.WithValue(ctx, "only_recorded", onlyRecorded)
+	ctx = context.WithValue(ctx, "manifest", cmdFlags.manifest)
+	ctx = context.WithValue(ctx, "recorded_paths", recordedPaths)
+	writeStats, readStats := NewIOStats("write", sizes), NewIOStats("read", sizes)
+	ctx = context.WithValue(ctx, "write_stats", writeStats)
+	ctx = context.WithValue(ctx, "read_stats", readStats)
+	if cmdFlags.seed != 0 {
+		fmt.Println("using content seed", cmdFlags.seed)
+		ctx = context.WithValue(ctx, "seed", cmdFlags.seed)
+	} else if strings.Compare(cmdFlags.verify, verifySeeded) == 0 {
+		fmt.Fprintln(os.Stderr, "-verify=seed requires -seed")
+		exitCode = exitBadArgs
+		return
+	}
 
-	// start files generation routine
-	rootPath := flag.Args()[0]
-	if len(rootPath) == 0 {
-		rootPath = cmdFlags.rootPath
+	runReport = NewRunReport(flags, rootPath)
+	if len(cmdFlags.command) > 0 {
+		runReport.Parameters["command"] = cmdFlags.command
 	}
 
+	// start files generation routine
+	// not closed: commands still running after the first error may send more
 	var errorChan = make(chan error)
-	defer close(errorChan)
+
+	var capacityDone *sync.WaitGroup
+	var capacityResult *CapacityResult
+	if capacityCheck {
+		fmt.Println("preparing to check the capacity")
+		capacityDone, capacityResult, err = CapacityCmd(ctx, rootPath, errorChan)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not check the capacity:", err)
+			exitCode = exitIOError
+			return
+		}
+	}
+
+	var metadataDone *sync.WaitGroup
+	var metadataResult *MetadataResult
+	if metadataCheck {
+		fmt.Println("preparing to stress the filesystem metadata")
+		metadataDone, metadataResult, err = MetadataCmd(ctx, rootPath, cmdFlags.files, metadataSize, errorChan)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not stress the metadata:", err)
+			exitCode = exitBadArgs
+			return
+		}
+	}
+
+	var cleanDone *sync.WaitGroup
+	var cleanResult *CleanResult
+	if cleaning {
+		var recorder IFileRecorder
+		if recordingStrategy != nil {
+			recorder = *recordingStrategy
+		}
+		cleanDone, cleanResult, err = CleanCmd(ctx, rootPath, cmdFlags.manifest, recorder, errorChan)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not clean:", err)
+			exitCode = exitBadArgs
+			return
+		}
+	}
 
 	var generateDone *sync.WaitGroup
-	if strings.Compare(cmdFlags.generate, "y") == 0 {
+	if generating {
 		fmt.Println("preparing to generate files")
 		fmt.Println("will generate", sizeFormat.ToString(sizeBytes))
-		generateDone = GenerateCmd(ctx, rootPath, int64(sizeBytes), recordingStrategy, errorChan, nil)
+		generateDone = GenerateCmd(ctx, rootPath, sizeBytes, recordingStrategy, errorChan, nil)
 	}
 
 	var verifyDone *sync.WaitGroup
-	if len(cmdFlags.verify) > 0 && recordingStrategy != nil {
+	var verifyResult *VerifyResult
+	if verifying {
 		fmt.Println("preparing to verify files")
 
-		// verify strictly after all recording has been done
-		if generateDone != nil {
-			generateDone.Wait()
-		}
+		verifyDone = &sync.WaitGroup{}
+		verifyDone.Add(1)
+		go func() {
+			defer verifyDone.Done()
 
-		wg, err := VerifyCmd(ctx, recordingStrategy, rootPath, errorChan)
-		if err != nil {
-			panic(err)
-		}
+			// verify strictly after all recording has been done, the errors of the generation are handled meanwhile
+			if generateDone != nil {
+				generateDone.Wait()
+			}
 
-		verifyDone = wg
-	} else {
+			// interrupted while generating: nothing to verify
+			if ctx.Err() != nil {
+				return
+			}
+
+			wg, result, err := VerifyCmd(ctx, verifyRecorder, rootPath, errorChan)
+			if err != nil {
+				errorChan <- fmt.Errorf("could not verify: %v", err)
+				return
+			}
+
+			verifyResult = result
+			wg.Wait()
+		}()
+	} else if !capacityCheck && !metadataCheck && !cleaning {
 		fmt.Println("no verification. please check your -verify flag")
 	}
 
+	allDone := waitForAllCommands(generateDone, verifyDone, capacityDone, metadataDone, cleanDone)
 loop:
 	for {
 		select {
-		case err, ok := <-errorChan:
-			//for now die on any error
-			if err != nil || !ok {
-				fmt.Fprintln(os.Stderr, err)
+		case err := <-errorChan:
+			fmt.Fprintln(os.Stderr, "ERR:", err)
+			runReport.AddError(err)
+			if onError.shouldStop(runReport.ErrorCount()) {
+				fmt.Fprintln(os.Stderr, "stopping after", runReport.ErrorCount(), "errors, see -onerror")
 				stopExecution()
+				break loop
 			}
-			break loop
 		case <-ctx.Done():
 			stopExecution()
 			fmt.Fprintln(os.Stderr, ctx.Err())
+			runReport.AddError(ctx.Err())
 			break loop
-		case numDone := <-waitForAllCommands(generateDone, verifyDone):
+		case numDone := <-allDone:
 			fmt.Println(numDone, "tasks completed")
 			break loop
 		}
 	}
 
+	// let the commands wind down: writers stop within a buffer, the files written before get recorded
+	stopExecution()
+windDown:
+	for {
+		select {
+		case err := <-errorChan:
+			if !errors.Is(err, context.Canceled) {
+				fmt.Fprintln(os.Stderr, "ERR: while stopping:", err)
+				runReport.AddError(err)
+			}
+		case <-allDone:
+			break windDown
+		}
+	}
+
+	writeStats.Print(os.Stdout)
+	readStats.Print(os.Stdout)
+	runReport.PrintErrors(os.Stderr)
+
+	runReport.Clean = cleanResult
+	runReport.Finish(writeStats, readStats, verifyResult, capacityResult, metadataResult)
+	if verifyResult != nil && shouldCleanUp(cmdFlags.cleanup, runReport.Verdict) {
+		cleanCtx := context.WithValue(signalled, "max_parallel", maxThreads)
+		runReport.Clean = cleanAfterRun(cleanCtx, rootPath, cmdFlags.manifest, verifyRecorder, runReport)
+		runReport.Finish(writeStats, readStats, verifyResult, capacityResult, metadataResult)
+	}
+	exitCode = runReport.ExitCode()
+	if exitCode == exitCancelled && generating && len(cmdFlags.manifest) > 0 {
+		resume := "-resume=y"
+		if len(cmdFlags.command) > 0 {
+			resume = "-resume"
+		}
+		fmt.Println("to continue the generation run again with", resume, "-manifest", cmdFlags.manifest)
+	}
+	writeReport(runReport, cmdFlags.report)
+
+	return
+}
+
+//writeReport writes runReport to path, if there is one
+func writeReport(runReport *RunReport, path string) {
+	if len(path) == 0 {
+		return
+	}
+
+	if err := runReport.WriteFile(path); err != nil {
+		fmt.Fprintln(os.Stderr, "could not write the report:", err)
+	} else {
+		fmt.Println("report written to", path, "verdict:", runReport.Verdict)
+	}
+}
+
+//adoptRecordedHash switches cmdFlags to the hash algorithm the files were recorded with, by source (md5 if none was recorded):
+//the recorded hashes can only be compared with ones of the same algorithm
+func adoptRecordedHash(cmdFlags *cmdFlags, recordedHash string, source string) error {
+	if len(recordedHash) == 0 {
+		recordedHash = hashMD5
+	}
+	if err := checkHash(recordedHash); err != nil {
+		return err
+	}
+	if recordedHash != cmdFlags.hash {
+		fmt.Println("using the", recordedHash, "hash algorithm of the", source, "instead of", cmdFlags.hash)
+		cmdFlags.hash = recordedHash
+	}
+
+	return nil
+}
+
+//adoptRecordedLayout switches cmdFlags to the size distribution and directory tree header was generated with, if it has them
+func adoptRecordedLayout(cmdFlags *cmdFlags, header manifestHeader) {
+	if len(header.Sizes) > 0 && header.Sizes != cmdFlags.sizes {
+		fmt.Println("using the sizes", header.Sizes, "of the manifest instead of", cmdFlags.sizes)
+		cmdFlags.sizes = header.Sizes
+	}
+
+	if tree := header.Tree; tree != nil {
+		if *tree != (manifestTree{cmdFlags.depth, cmdFlags.fanOut, cmdFlags.filesPerDir, cmdFlags.nameLen, cmdFlags.charset}) {
+			fmt.Println("using the directory tree of the manifest instead of the -depth, -fanout, -filesperdir, -namelen and -charset given")
+		}
+		cmdFlags.depth = tree.Depth
+		cmdFlags.fanOut = tree.FanOut
+		cmdFlags.filesPerDir = tree.FilesPerDir
+		cmdFlags.nameLen = tree.NameLen
+		cmdFlags.charset = tree.Charset
+	}
+}
+
+//done ends a run that started, waiting for return first if asked to
+func done(cmdFlags *cmdFlags) {
 	fmt.Println("All done, exiting")
 	if strings.Compare(cmdFlags.waitBeforeExit, "y") == 0 {
 		fmt.Println("Press return to exit...")
@@ -204,6 +704,37 @@ loop:
 	}
 }
 
+//cleanAfterRun removes the files generated at rootPath once the run is over, adding its errors to runReport
+func cleanAfterRun(ctx context.Context, rootPath string, manifest string, recorder *IFileRecorder, runReport *RunReport) *CleanResult {
+	if len(manifest) == 0 && recorder == nil {
+		fmt.Fprintln(os.Stderr, "WARN: not cleaning up: without a -manifest or a recorder the generated files can't be told. use the clean command with -byname")
+		return nil
+	}
+
+	var rec IFileRecorder
+	if recorder != nil {
+		rec = *recorder
+	}
+	errorChan := make(chan error)
+	cleanDone, cleanResult, err := CleanCmd(ctx, rootPath, manifest, rec, errorChan)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not clean up:", err)
+		runReport.AddError(err)
+		return nil
+	}
+
+	allDone := waitForAllCommands(cleanDone)
+	for {
+		select {
+		case err := <-errorChan:
+			fmt.Fprintln(os.Stderr, "ERR:", err)
+			runReport.AddError(err)
+		case <-allDone:
+			return cleanResult
+		}
+	}
+}
+
 func waitForAllCommands(cmds ...*sync.WaitGroup) chan rune {
 	res := make(chan rune)
 	var cnt rune
@@ -258,3 +789,23 @@ func GetIntOrDefault(ctx context.Context, key interface{}, def int) int {
 
 	return val.(int)
 }
+
+//GetInt64OrDefault return the int64 vaue from context or specified default
+func GetInt64OrDefault(ctx context.Context, key interface{}, def int64) int64 {
+	val := ctx.Value(key)
+	if val == nil {
+		return def
+	}
+
+	return val.(int64)
+}
+
+//GetStringOrDefault return the string vaue from context or specified default
+func GetStringOrDefault(ctx context.Context, key interface{}, def string) string {
+	val := ctx.Value(key)
+	if val == nil {
+		return def
+	}
+
+	return val.(string)
+}
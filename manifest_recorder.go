@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const manifestVersion = 1
+
+type (
+	manifestHeader struct {
+		Version int       `json:"version"`
+		Root    string    `json:"root"`
+		Created time.Time `json:"created"`
+		Seed    int64     `json:"seed,omitempty"`
+		// total size to generate, so an interrupted generation can be resumed
+		Size int64 `json:"size,omitempty"`
+		// algorithm of the file hashes, md5 if empty
+		Hash string `json:"hash,omitempty"`
+		// -sizes of the run, so a resumed generation keeps the size distribution
+		Sizes string `json:"sizes,omitempty"`
+		// directory tree of the run, nil in manifests written before it was recorded
+		Tree *manifestTree `json:"tree,omitempty"`
+	}
+
+	//manifestTree is the tree shape a manifest was generated with, as set by the -depth, -fanout, -filesperdir, -namelen and -charset flags
+	manifestTree struct {
+		Depth       int    `json:"depth"`
+		FanOut      int    `json:"fanout"`
+		FilesPerDir int    `json:"filesperdir"`
+		NameLen     int    `json:"namelen"`
+		Charset     string `json:"charset"`
+	}
+
+	manifestEntry struct {
+		Path string `json:"path"`
+		Size int64  `json:"size"`
+		Hash string `json:"hash"`
+		// packed block checksums, see encodeBlocks
+		Blocks []byte `json:"blocks,omitempty"`
+	}
+
+	//ManifestRecorder appends every recorded file to a manifest file, so it can be verified by a later run.
+	//Everything else is delegated to the wrapped recorder, if any
+	ManifestRecorder struct {
+		inner    IFileRecorder
+		rootPath string
+		file     *os.File
+		header   manifestHeader
+		recorded int64
+		lock     sync.Mutex
+	}
+)
+
+var errNoInnerRecorder = errors.New("manifest is write-only: no recorder to verify against")
+
+//NewManifestRecorder constructor. A fresh manifest with the run parameters from fresh is started at path,
+//otherwise (fresh is nil) the existing one is loaded into inner and appended to.
+//Paths are kept relative to rootPath, so the volume can be mounted elsewhere for verification
+func NewManifestRecorder(path string, rootPath string, inner IFileRecorder, fresh *manifestHeader) (*ManifestRecorder, error) {
+	if len(path) == 0 {
+		return nil, errors.New("manifest path can't be empty")
+	}
+
+	rec := &ManifestRecorder{
+		inner:    inner,
+		rootPath: rootPath,
+	}
+
+	if fresh != nil {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		rec.file = f
+
+		absRoot, err := filepath.Abs(rootPath)
+		if err != nil {
+			absRoot = rootPath
+		}
+		rec.header = *fresh
+		rec.header.Version = manifestVersion
+		rec.header.Root = absRoot
+		rec.header.Created = time.Now()
+		if err := rec.writeLine(&rec.header); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		return rec, nil
+	}
+
+	if err := rec.load(path); err != nil {
+		return nil, fmt.Errorf("could not load manifest %s: %v", path, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	rec.file = f
+
+	return rec, nil
+}
+
+func (rec *ManifestRecorder) load(path string) error {
+	header, err := scanManifest(path, rec.rootPath, func(file *TempFile) error {
+		rec.recorded += file.size
+		if rec.inner != nil {
+			return rec.inner.RecordFile(file)
+		}
+		return nil
+	})
+	rec.header = header
+
+	return err
+}
+
+//scanManifest reads the manifest at path, calls each for every file in it, with the path below rootPath. returns the header
+func scanManifest(path string, rootPath string, each func(file *TempFile) error) (manifestHeader, error) {
+	header := manifestHeader{}
+	f, err := os.Open(path)
+	if err != nil {
+		return header, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return header, err
+		}
+		return header, errors.New("manifest is empty")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return header, fmt.Errorf("bad header: %v", err)
+	}
+	if header.Version != manifestVersion {
+		return header, fmt.Errorf("unsupported manifest version %d", header.Version)
+	}
+
+	line := 1
+	for scanner.Scan() {
+		line++
+		entry := manifestEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// the last line may be cut short if the previous run was interrupted
+			fmt.Fprintln(os.Stderr, "WARN: skipping manifest line", line, err)
+			continue
+		}
+
+		file := &TempFile{
+			path:   filepath.Join(rootPath, filepath.FromSlash(entry.Path)),
+			size:   entry.Size,
+			hash:   entry.Hash,
+			blocks: decodeBlocks(entry.Blocks),
+		}
+		if err := each(file); err != nil {
+			return header, err
+		}
+	}
+
+	return header, scanner.Err()
+}
+
+func (rec *ManifestRecorder) writeLine(value interface{}) error {
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	// one write per line: a crash can only lose the line being written
+	_, err = rec.file.Write(append(line, '\n'))
+	return err
+}
+
+//Header returns the parameters of the run that started the manifest
+func (rec *ManifestRecorder) Header() manifestHeader {
+	return rec.header
+}
+
+//Recorded returns the total size of the files in the manifest
+func (rec *ManifestRecorder) Recorded() int64 {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	return rec.recorded
+}
+
+//Close flushes the manifest to disk
+func (rec *ManifestRecorder) Close() error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	if err := rec.file.Sync(); err != nil {
+		rec.file.Close()
+		return err
+	}
+
+	return rec.file.Close()
+}
+
+//RecordFile implements IFileRecorder
+func (rec *ManifestRecorder) RecordFile(file *TempFile) error {
+	if file == nil {
+		return errors.New("temp file can't be null")
+	}
+
+	relPath, err := filepath.Rel(rec.rootPath, file.path)
+	if err != nil {
+		return err
+	}
+
+	rec.lock.Lock()
+	err = rec.writeLine(&manifestEntry{
+		Path:   filepath.ToSlash(relPath),
+		Size:   file.size,
+		Hash:   file.hash,
+		Blocks: encodeBlocks(file.blocks),
+	})
+	if err == nil {
+		rec.recorded += file.size
+	}
+	rec.lock.Unlock()
+
+	if err != nil || rec.inner == nil {
+		return err
+	}
+
+	return rec.inner.RecordFile(file)
+}
+
+//VerifyFileExits implements IFileRecorder
+func (rec *ManifestRecorder) VerifyFileExits(file *TempFile) (bool, error) {
+	if rec.inner == nil {
+		return false, errNoInnerRecorder
+	}
+
+	return rec.inner.VerifyFileExits(file)
+}
+
+//MarkFileExits implements IFileRecorder
+func (rec *ManifestRecorder) MarkFileExits(file *TempFile) (bool, error) {
+	if rec.inner == nil {
+		return false, errNoInnerRecorder
+	}
+
+	return rec.inner.MarkFileExits(file)
+}
+
+//FindFileByPath implements IFileRecorder
+func (rec *ManifestRecorder) FindFileByPath(path string) (*TempFile, error) {
+	if rec.inner == nil {
+		return nil, errNoInnerRecorder
+	}
+
+	return rec.inner.FindFileByPath(path)
+}
+
+//MarkPathExists implements IFileRecorder
+func (rec *ManifestRecorder) MarkPathExists(path string) (bool, error) {
+	if rec.inner == nil {
+		return false, errNoInnerRecorder
+	}
+
+	return rec.inner.MarkPathExists(path)
+}
+
+//FilesNotCheckedYet implements IFileRecorder
+func (rec *ManifestRecorder) FilesNotCheckedYet() ([]*TempFile, error) {
+	if rec.inner == nil {
+		return nil, errNoInnerRecorder
+	}
+
+	return rec.inner.FilesNotCheckedYet()
+}
+
+//GetTotalUnmarked implements IFileRecorder. Without a recorder to verify against nothing is ever marked
+func (rec *ManifestRecorder) GetTotalUnmarked() (int64, error) {
+	if rec.inner == nil {
+		rec.lock.Lock()
+		defer rec.lock.Unlock()
+		return rec.recorded, nil
+	}
+
+	return rec.inner.GetTotalUnmarked()
+}
+
+//GetTotalMarked implements IFileRecorder
+func (rec *ManifestRecorder) GetTotalMarked() (int64, error) {
+	if rec.inner == nil {
+		return 0, nil
+	}
+
+	return rec.inner.GetTotalMarked()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewManifestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := NewManifestRecorder("", "/data", nil, &manifestHeader{}); err == nil {
+		t.Error("expected error on empty path")
+	}
+
+	if _, err := NewManifestRecorder(filepath.Join(dir, "missing"), "/data", nil, nil); err == nil {
+		t.Error("expected error on missing manifest")
+	}
+
+	garbage := filepath.Join(dir, "garbage")
+	ioutil.WriteFile(garbage, []byte("not a manifest\n"), 0644)
+	if _, err := NewManifestRecorder(garbage, "/data", nil, nil); err == nil {
+		t.Error("expected error on bad header")
+	}
+}
+
+func TestManifestRecordAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, "manifest")
+
+	// generation run: write-only manifest
+	rec, err := NewManifestRecorder(manifestPath, "/mnt/a", nil, &manifestHeader{Seed: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec.RecordFile(&TempFile{path: "/mnt/a/file_0.tmp", size: 2, hash: "hash1"})
+	rec.RecordFile(&TempFile{path: "/mnt/a/subfolder_0.tmp/file_0.tmp", size: 3, hash: "hash2"})
+
+	if total, err := rec.GetTotalUnmarked(); err != nil || total != 5 {
+		t.Error("expected 5 recorded bytes, got", total, err)
+	}
+	if _, err := rec.FilesNotCheckedYet(); err == nil {
+		t.Error("expected error without inner recorder")
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// verification run: the volume is now mounted elsewhere
+	inner := NewInMemRecorder()
+	rec, err = NewManifestRecorder(manifestPath, "/mnt/b", inner, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+
+	if rec.Header().Seed != 42 {
+		t.Error("expected seed 42 to be loaded, got", rec.Header().Seed)
+	}
+
+	if total, err := rec.GetTotalUnmarked(); err != nil || total != 5 {
+		t.Error("expected 5 loaded bytes, got", total, err)
+	}
+
+	if marked, err := rec.MarkFileExits(&TempFile{hash: "hash1"}); !marked || err != nil {
+		t.Error("unexpected", marked, err)
+	}
+
+	notChecked, err := rec.FilesNotCheckedYet()
+	if err != nil || len(notChecked) != 1 {
+		t.Fatal("unexpected", err, notChecked)
+	}
+
+	expectedPath := filepath.Join("/mnt/b", "subfolder_0.tmp", "file_0.tmp")
+	if strings.Compare(notChecked[0].path, expectedPath) != 0 {
+		t.Error("expected", expectedPath, "got", notChecked[0].path)
+	}
+}
+
+func TestManifestResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, "manifest")
+
+	rec, err := NewManifestRecorder(manifestPath, "/mnt/a", nil, &manifestHeader{Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.RecordFile(&TempFile{path: "/mnt/a/file_0.tmp", size: 4, hash: "hash1"})
+	rec.Close()
+
+	// interrupted: the resumed run appends to the same manifest
+	rec, err = NewManifestRecorder(manifestPath, "/mnt/a", NewInMemRecorder(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Header().Size != 10 || rec.Recorded() != 4 {
+		t.Error("unexpected size to resume", rec.Header().Size, rec.Recorded())
+	}
+	if found, err := rec.FindFileByPath("/mnt/a/file_0.tmp"); found == nil || err != nil {
+		t.Error("expected the generated file to be found", found, err)
+	}
+
+	rec.RecordFile(&TempFile{path: "/mnt/a/file_1.tmp", size: 6, hash: "hash2"})
+	rec.Close()
+
+	rec, err = NewManifestRecorder(manifestPath, "/mnt/a", NewInMemRecorder(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	if rec.Recorded() != 10 {
+		t.Error("expected 10 recorded bytes, got", rec.Recorded())
+	}
+}
+
+func TestManifestHashAlgorithm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, "manifest")
+
+	rec, err := NewManifestRecorder(manifestPath, "/mnt/a", nil, &manifestHeader{Hash: hashXXHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+
+	rec, err = NewManifestRecorder(manifestPath, "/mnt/a", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	if rec.Header().Hash != hashXXHash {
+		t.Error("expected the hash algorithm to be kept, got", rec.Header().Hash)
+	}
+}
+
+func TestManifestLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, "manifest")
+
+	tree := manifestTree{Depth: 0, FanOut: 3, FilesPerDir: 7, NameLen: 40, Charset: charsetUnicode}
+	rec, err := NewManifestRecorder(manifestPath, "/mnt/a", nil, &manifestHeader{Sizes: "fixed=1MB", Tree: &tree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+
+	rec, err = NewManifestRecorder(manifestPath, "/mnt/a", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	header := rec.Header()
+	if header.Sizes != "fixed=1MB" || header.Tree == nil || *header.Tree != tree {
+		t.Error("expected the size profile and the tree to be kept, got", header.Sizes, header.Tree)
+	}
+}
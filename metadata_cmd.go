@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+type (
+	//MetadataResult holds the outcome of MetadataCmd
+	MetadataResult struct {
+		Files   int64 `json:"files"`
+		Created int64 `json:"created"`
+		Stated  int64 `json:"stated"`
+		Deleted int64 `json:"deleted"`
+		Bytes   int64 `json:"bytes"`
+		// files whose size read back differs from the one written
+		SizeMismatches   int64   `json:"size_mismatches"`
+		CreatesPerSecond float64 `json:"creates_per_second"`
+		StatsPerSecond   float64 `json:"stats_per_second"`
+		DeletesPerSecond float64 `json:"deletes_per_second"`
+		// the filesystem ran out of space or inodes before all files were created
+		Full       bool  `json:"filesystem_full"`
+		InodesFree int64 `json:"inodes_free"`
+	}
+
+	//metadataPlan lays files out in the folders of the tree shape: file i is file i%filesPerDir of folder i/filesPerDir,
+	//folders numbered breadth first, so the path of a file is known without keeping any of them in memory
+	metadataPlan struct {
+		root    string
+		shape   *treeShape
+		maxSize int64
+		seed    uint64
+	}
+)
+
+//Mismatch tells if any file did not stat back with the size it was written with
+func (res *MetadataResult) Mismatch() bool {
+	return res.SizeMismatches > 0
+}
+
+//Print writes the rates of the phases to w
+func (res *MetadataResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "metadata: %d of %d files created (%s)\n", res.Created, res.Files, sizeFormat.ToString(res.Bytes))
+	fmt.Fprintf(w, "  creates/s: %s\n", formatRate(res.CreatesPerSecond))
+	fmt.Fprintf(w, "  stats/s:   %s (%d size mismatches)\n", formatRate(res.StatsPerSecond), res.SizeMismatches)
+	fmt.Fprintf(w, "  deletes/s: %s (%d deleted)\n", formatRate(res.DeletesPerSecond), res.Deleted)
+	if res.Full {
+		fmt.Fprintf(w, "  the filesystem was full after %d files, %d inodes free\n", res.Created, res.InodesFree)
+	}
+}
+
+//MetadataCmd creates tiny files (0 to maxSize bytes) in the folders of the tree shape,
+//stats and then deletes them, measuring the rate of every phase. The result is populated once the returned WaitGroup is done
+func MetadataCmd(ctx context.Context, rootPath string, files int64, maxSize int64, errorChan chan<- error) (*sync.WaitGroup, *MetadataResult, error) {
+	plan := &metadataPlan{root: rootPath, shape: getTreeShape(ctx), maxSize: maxSize, seed: uint64(time.Now().UnixNano())}
+	if max := plan.maxFiles(); max >= 0 && files > max {
+		return nil, nil, fmt.Errorf("%d files do not fit into the tree of %d, allow more depth, fan-out or files per directory", files, max)
+	}
+	if files <= 0 {
+		return nil, nil, fmt.Errorf("bad number of files %d", files)
+	}
+
+	ctx = context.WithValue(ctx, "volume_root", rootPath)
+	workers := GetIntOrDefault(ctx, "max_parallel", 1)
+	result := &MetadataResult{Files: files}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		created := make([]bool, files)
+
+		// the folders are not part of the measurement
+		if err := plan.makeFolders(ctx, files); err != nil {
+			errorChan <- newFileError(errCategoryWrite, "", err)
+			plan.removeFolders(files)
+			return
+		}
+
+		// running out of space or inodes ends the create phase, but is what is being looked for rather than an error
+		var full int32
+		fmt.Println("creating", files, "files using", workers, "workers")
+		elapsed := runMetadataPhase(ctx, files, workers, func(ctx context.Context, i int64) bool {
+			if atomic.LoadInt32(&full) != 0 {
+				return false
+			}
+
+			err := plan.create(ctx, i)
+			if errors.Is(err, syscall.ENOSPC) {
+				atomic.StoreInt32(&full, 1)
+				return false
+			}
+			if err != nil {
+				errorChan <- newFileError(errCategoryWrite, plan.path(i), err)
+				return true
+			}
+
+			created[i] = true
+			atomic.AddInt64(&result.Created, 1)
+			atomic.AddInt64(&result.Bytes, plan.size(i))
+			return true
+		})
+		// the rate of a phase cut short by stopping would be off
+		if ctx.Err() == nil {
+			result.CreatesPerSecond = perSecond(result.Created, elapsed)
+		}
+		if full != 0 {
+			result.Full = true
+			if _, free, err := diskInodes(rootPath); err == nil {
+				result.InodesFree = free
+			}
+			fmt.Fprintln(os.Stderr, "WARN: the filesystem is full after", result.Created, "files")
+		}
+
+		if ctx.Err() == nil {
+			fmt.Println("stating", result.Created, "files")
+			elapsed = runMetadataPhase(ctx, files, workers, func(ctx context.Context, i int64) bool {
+				if !created[i] {
+					return true
+				}
+
+				info, err := os.Lstat(plan.path(i))
+				if err != nil {
+					errorChan <- newFileError(errCategoryRead, plan.path(i), err)
+					return true
+				}
+
+				atomic.AddInt64(&result.Stated, 1)
+				if info.Size() != plan.size(i) {
+					fmt.Fprintln(os.Stderr, "ERR: file", plan.path(i), "is", info.Size(), "bytes instead of", plan.size(i))
+					atomic.AddInt64(&result.SizeMismatches, 1)
+				}
+				return true
+			})
+			if ctx.Err() == nil {
+				result.StatsPerSecond = perSecond(result.Stated, elapsed)
+			}
+		}
+
+		// the files created are deleted even once stopped, so none are left behind: unlike the other phases
+		// this one isn't cut short by ctx. a second signal still exits right away
+		fmt.Println("deleting", result.Created, "files")
+		elapsed = runMetadataPhase(context.Background(), files, workers, func(ctx context.Context, i int64) bool {
+			if !created[i] {
+				return true
+			}
+
+			if err := os.Remove(plan.path(i)); err != nil {
+				errorChan <- newFileError(errCategoryWrite, plan.path(i), err)
+				return true
+			}
+
+			atomic.AddInt64(&result.Deleted, 1)
+			return true
+		})
+		result.DeletesPerSecond = perSecond(result.Deleted, elapsed)
+		plan.removeFolders(files)
+
+		result.Print(os.Stdout)
+	}()
+
+	return &wg, result, nil
+}
+
+//runMetadataPhase calls op for 0..files-1 from workers goroutines until op returns false or ctx is done.
+//Every worker has its own random stream in the ctx passed to op. returns how long it took
+func runMetadataPhase(ctx context.Context, files int64, workers int, op func(ctx context.Context, i int64) bool) time.Duration {
+	start := time.Now()
+	next := int64(-1)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			ctx := context.WithValue(ctx, "random_stream", newRandomStream())
+			for i := atomic.AddInt64(&next, 1); i < files && ctx.Err() == nil; i = atomic.AddInt64(&next, 1) {
+				if !op(ctx, i) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return time.Since(start)
+}
+
+//formatRate formats the rate of a phase. there is none for a phase cut short
+func formatRate(rate float64) string {
+	if rate == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.0f", rate)
+}
+
+func perSecond(count int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(count) / elapsed.Seconds()
+}
+
+//maxFiles is the number of files the tree holds, -1 unlimited
+func (plan *metadataPlan) maxFiles() int64 {
+	if plan.shape.depth < 0 {
+		return -1
+	}
+
+	folders, level := int64(1), int64(1)
+	for d := 0; d < plan.shape.depth; d++ {
+		level *= int64(plan.shape.fanOut)
+		folders += level
+		if folders > 1<<40 {
+			return -1
+		}
+	}
+
+	return folders * int64(plan.shape.filesPerDir)
+}
+
+//folderPath is the path of folder k: folder 0 is the root, the children of folder k are k*fanOut+1 to k*fanOut+fanOut
+func (plan *metadataPlan) folderPath(k int64) string {
+	if k == 0 {
+		return plan.root
+	}
+
+	fanOut := int64(plan.shape.fanOut)
+	return filepath.Join(plan.folderPath((k-1)/fanOut), plan.shape.folderName(int((k-1)%fanOut)))
+}
+
+func (plan *metadataPlan) path(i int64) string {
+	filesPerDir := int64(plan.shape.filesPerDir)
+	return filepath.Join(plan.folderPath(i/filesPerDir), plan.shape.fileName(int(i%filesPerDir)))
+}
+
+//size of file i, 0 to maxSize. derived from i, so it is known again when the file is stated
+func (plan *metadataPlan) size(i int64) int64 {
+	// splitmix64
+	z := plan.seed + uint64(i)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+
+	return int64(z % uint64(plan.maxSize+1))
+}
+
+func (plan *metadataPlan) create(ctx context.Context, i int64) error {
+	path := plan.path(i)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := plan.write(ctx, f, i); err != nil {
+		// not created: nothing to stat or delete later
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+//write fills the file i opened as f, closes and syncs it as set by the sync policy in ctx
+func (plan *metadataPlan) write(ctx context.Context, f *os.File, i int64) error {
+	if size := plan.size(i); size > 0 {
+		content := make([]byte, size)
+		getRandomStream(ctx).Fill(content)
+		if _, err := f.Write(content); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	durability := getSyncPolicy(ctx)
+	if durability.perFile {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if durability.dirs {
+		return syncDir(filepath.Dir(f.Name()))
+	}
+
+	return nil
+}
+
+//makeFolders creates the folders of the first files files, with the directory sync policy
+func (plan *metadataPlan) makeFolders(ctx context.Context, files int64) error {
+	filesPerDir := int64(plan.shape.filesPerDir)
+	for k := int64(1); k <= (files-1)/filesPerDir; k++ {
+		if err := makeParentDir(ctx, plan.path(k*filesPerDir)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//removeFolders removes the folders the files were created in, deepest first. folders still holding other files are left
+func (plan *metadataPlan) removeFolders(files int64) {
+	filesPerDir := int64(plan.shape.filesPerDir)
+	for k := (files - 1) / filesPerDir; k > 0; k-- {
+		os.Remove(plan.folderPath(k))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetadataPlan(t *testing.T) {
+	shape, _ := newTreeShape(2, 2, 3, 0, charsetASCII)
+	plan := &metadataPlan{root: "r", shape: shape, maxSize: 10, seed: 42}
+
+	if max := plan.maxFiles(); max != 21 {
+		t.Error("expected 21 files in 7 folders, got", max)
+	}
+
+	for i, expected := range map[int64]string{
+		0:  filepath.Join("r", "file_0.tmp"),
+		4:  filepath.Join("r", "subfolder_0.tmp", "file_1.tmp"),
+		6:  filepath.Join("r", "subfolder_1.tmp", "file_0.tmp"),
+		20: filepath.Join("r", "subfolder_1.tmp", "subfolder_1.tmp", "file_2.tmp"),
+	} {
+		if path := plan.path(i); path != expected {
+			t.Error(i, "expected", expected, "got", path)
+		}
+	}
+
+	for i := int64(0); i < 100; i++ {
+		if size := plan.size(i); size < 0 || size > plan.maxSize || size != plan.size(i) {
+			t.Error("unexpected size", size)
+		}
+	}
+
+	if max := (&metadataPlan{shape: defaultTreeShape()}).maxFiles(); max != -1 {
+		t.Error("expected unlimited, got", max)
+	}
+}
+
+func TestMetadataCmd(t *testing.T) {
+	root, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	shape, _ := newTreeShape(-1, 2, 10, 0, charsetASCII)
+	ctx := context.WithValue(context.Background(), "tree_shape", shape)
+	ctx = context.WithValue(ctx, "max_parallel", 4)
+	errCh := make(chan error)
+	go func() {
+		for err := range errCh {
+			t.Error(err)
+		}
+	}()
+
+	wg, result, err := MetadataCmd(ctx, root, 95, 100, errCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if result.Created != 95 || result.Stated != 95 || result.Deleted != 95 || result.Mismatch() || result.Full {
+		t.Error("unexpected", result)
+	}
+	if result.CreatesPerSecond <= 0 || result.StatsPerSecond <= 0 || result.DeletesPerSecond <= 0 {
+		t.Error("expected rates, got", result)
+	}
+
+	// the emptied folders are removed as well
+	if left, _ := ioutil.ReadDir(root); len(left) != 0 {
+		t.Error("expected nothing left, got", len(left))
+	}
+
+	shape, _ = newTreeShape(0, 2, 10, 0, charsetASCII)
+	if _, _, err := MetadataCmd(context.WithValue(ctx, "tree_shape", shape), root, 11, 100, errCh); err == nil {
+		t.Error("expected error for files not fitting the tree")
+	}
+	close(errCh)
+}
+
+func TestMetadataCmdStopped(t *testing.T) {
+	root, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// the file in the way of the 6th one fails its creation, which stops the run
+	writeTestFiles(t, root, "file_5.tmp")
+
+	shape, _ := newTreeShape(-1, 2, 10, 0, charsetASCII)
+	ctx := context.WithValue(context.Background(), "tree_shape", shape)
+	ctx = context.WithValue(ctx, "max_parallel", 1)
+	ctx, stop := context.WithCancel(ctx)
+	errCh := make(chan error)
+	go func() {
+		for range errCh {
+			stop()
+		}
+	}()
+
+	wg, result, err := MetadataCmd(ctx, root, 95, 100, errCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(errCh)
+
+	if result.Created == 95 || result.Deleted != result.Created || result.Stated != 0 {
+		t.Error("expected the files created to be deleted once stopped, got", result)
+	}
+	if result.CreatesPerSecond != 0 || result.StatsPerSecond != 0 {
+		t.Error("expected no rates for the phases cut short, got", result)
+	}
+	if left, _ := ioutil.ReadDir(root); len(left) != 1 {
+		t.Error("expected only the file in the way left, got", len(left))
+	}
+}
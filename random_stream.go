@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+type (
+	//randomStream is a fast source of random file content: the AES-CTR key stream under a random key.
+	//Not safe for concurrent use: every writer has its own, see writeVolume
+	randomStream struct {
+		stream cipher.Stream
+	}
+)
+
+//newRandomStream constructor. Every stream is keyed independently, so no two produce the same content
+func newRandomStream() *randomStream {
+	key := make([]byte, 32+aes.BlockSize)
+	if _, err := crand.Read(key); err != nil {
+		// no system entropy: unique enough for test data
+		binary.LittleEndian.PutUint64(key, uint64(time.Now().UnixNano()))
+	}
+
+	// only fails on a bad key size
+	block, _ := aes.NewCipher(key[:32])
+	return &randomStream{stream: cipher.NewCTR(block, key[32:])}
+}
+
+//getRandomStream returns the stream of the writer stored in ctx, or a new one
+func getRandomStream(ctx context.Context) *randomStream {
+	if rs, ok := ctx.Value("random_stream").(*randomStream); ok {
+		return rs
+	}
+
+	return newRandomStream()
+}
+
+//Fill overwrites buf with random bytes
+func (rs *randomStream) Fill(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	rs.stream.XORKeyStream(buf, buf)
+}
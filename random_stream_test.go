@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+func TestRandomStream(t *testing.T) {
+	a, b := make([]byte, 4096), make([]byte, 4096)
+	first, second := newRandomStream(), newRandomStream()
+
+	first.Fill(a)
+	second.Fill(b)
+	if bytes.Equal(a, b) {
+		t.Error("expected independent streams")
+	}
+	if bytes.Equal(a, make([]byte, len(a))) {
+		t.Error("expected random content")
+	}
+
+	previous := append([]byte{}, a...)
+	first.Fill(a)
+	if bytes.Equal(a, previous) {
+		t.Error("expected the stream to move on")
+	}
+
+	ctx := context.WithValue(context.Background(), "random_stream", first)
+	if getRandomStream(ctx) != first || getRandomStream(context.Background()) == nil {
+		t.Error("unexpected stream from context")
+	}
+}
+
+//data generation throughput, without the disk
+
+func BenchmarkRandomStream(b *testing.B) {
+	b.SetBytes(sizeFormat.MB)
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]byte, sizeFormat.MB)
+		random := newRandomStream()
+		for pb.Next() {
+			random.Fill(buf)
+		}
+	})
+}
+
+func BenchmarkGlobalMathRand(b *testing.B) {
+	b.SetBytes(sizeFormat.MB)
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]byte, sizeFormat.MB)
+		for pb.Next() {
+			rand.Read(buf)
+		}
+	})
+}
+
+func BenchmarkSeededContent(b *testing.B) {
+	b.SetBytes(sizeFormat.MB)
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]byte, sizeFormat.MB)
+		seeded := NewSeededContent(42, "bench")
+		offset := int64(0)
+		for pb.Next() {
+			seeded.Fill(buf, offset)
+			offset += int64(len(buf))
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+const (
+	verdictPass  = "pass"
+	verdictFail  = "fail"
+	verdictError = "error"
+	// interrupted by the user
+	verdictCancelled = "cancelled"
+)
+
+type (
+	//RunReport is the machine readable summary of a run, written with -report
+	RunReport struct {
+		Parameters map[string]string `json:"parameters"`
+		Started    time.Time         `json:"started"`
+		Finished   time.Time         `json:"finished"`
+		Seconds    float64           `json:"seconds"`
+		Write      *IOSummary        `json:"write,omitempty"`
+		Read       *IOSummary        `json:"read,omitempty"`
+		Verify     *VerifyResult     `json:"verify,omitempty"`
+		Capacity   *CapacityResult   `json:"capacity,omitempty"`
+		Metadata   *MetadataResult   `json:"metadata,omitempty"`
+		Clean      *CleanResult      `json:"clean,omitempty"`
+		BurnIn     *BurnInResult     `json:"burn_in,omitempty"`
+		Bench      []*BenchResult    `json:"bench,omitempty"`
+		// category -> errors in that category
+		Errors map[string][]*loggedError `json:"errors"`
+		// pass, fail (the data did not verify), error (the run did not complete) or cancelled
+		Verdict string `json:"verdict"`
+
+		cancelled  bool
+		errorCount int
+	}
+
+	loggedError struct {
+		Path  string `json:"path,omitempty"`
+		Error string `json:"error"`
+	}
+)
+
+//NewRunReport constructor. Records the values of all flags in flags as the run parameters
+func NewRunReport(flags *flag.FlagSet, rootPath string) *RunReport {
+	report := &RunReport{
+		Parameters: map[string]string{"path": rootPath},
+		Started:    time.Now(),
+		Errors:     make(map[string][]*loggedError),
+	}
+
+	flags.VisitAll(func(f *flag.Flag) {
+		report.Parameters[f.Name] = f.Value.String()
+	})
+
+	return report
+}
+
+//LoadRunReport reads a report written by WriteFile
+func LoadRunReport(path string) (*RunReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RunReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("%s is not a disktest report: %v", path, err)
+	}
+	for _, logged := range report.Errors {
+		report.errorCount += len(logged)
+	}
+
+	return report, nil
+}
+
+//AddError records an error of the run under its category, see FileError
+func (report *RunReport) AddError(err error) {
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, context.Canceled) {
+		report.cancelled = true
+	}
+	category, logged := errCategoryOther, &loggedError{Error: err.Error()}
+	var fileErr *FileError
+	if errors.As(err, &fileErr) {
+		category = fileErr.Category
+		logged = &loggedError{Path: fileErr.Path, Error: fileErr.Err.Error()}
+	}
+
+	report.Errors[category] = append(report.Errors[category], logged)
+	report.errorCount++
+}
+
+//merge adds the errors of another run, e.g. a pass of a burn-in
+func (report *RunReport) merge(other *RunReport) {
+	for category, logged := range other.Errors {
+		report.Errors[category] = append(report.Errors[category], logged...)
+	}
+	report.errorCount += other.errorCount
+	report.cancelled = report.cancelled || other.cancelled
+}
+
+//ErrorCount returns the number of errors added
+func (report *RunReport) ErrorCount() int {
+	return report.errorCount
+}
+
+//PrintErrors writes the errors by category in a human readable form
+func (report *RunReport) PrintErrors(w io.Writer) {
+	if report.errorCount == 0 {
+		return
+	}
+
+	categories := make([]string, 0, len(report.Errors))
+	for category := range report.Errors {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	fmt.Fprintln(w, report.errorCount, "errors:")
+	for _, category := range categories {
+		fmt.Fprintf(w, "  %s: %d\n", category, len(report.Errors[category]))
+		for _, logged := range report.Errors[category] {
+			if len(logged.Path) > 0 {
+				fmt.Fprintf(w, "    %s: %s\n", logged.Path, logged.Error)
+			} else {
+				fmt.Fprintln(w, "   ", logged.Error)
+			}
+		}
+	}
+}
+
+//Finish collects the results of the commands that ran, nil if one didn't, and settles the verdict
+func (report *RunReport) Finish(writeStats, readStats *IOStats, verify *VerifyResult, capacity *CapacityResult, metadata *MetadataResult) {
+	report.Finished = time.Now()
+	report.Seconds = report.Finished.Sub(report.Started).Seconds()
+	report.Write = writeStats.Summary()
+	report.Read = readStats.Summary()
+	report.Verify = verify
+	report.Capacity = capacity
+	report.Metadata = metadata
+
+	switch {
+	case report.cancelled:
+		report.Verdict = verdictCancelled
+	case report.errorCount > 0:
+		report.Verdict = verdictError
+	case verify != nil && !verify.Success(), capacity != nil && capacity.Mismatch(), metadata != nil && metadata.Mismatch():
+		report.Verdict = verdictFail
+	default:
+		report.Verdict = verdictPass
+	}
+}
+
+//ExitCode maps the outcome of a finished run to the process exit code
+func (report *RunReport) ExitCode() int {
+	switch {
+	case report.Verdict == verdictCancelled:
+		return exitCancelled
+	case report.Verdict == verdictError:
+		return exitIOError
+	case report.Capacity != nil && report.Capacity.Mismatch():
+		return exitMismatch
+	case report.Metadata != nil && report.Metadata.Mismatch():
+		return exitMismatch
+	case report.Verify != nil && len(report.Verify.Mismatched)+len(report.Verify.Truncated) > 0:
+		return exitMismatch
+	case report.Verify != nil && (len(report.Verify.Missing) > 0 || report.Verify.Incomplete):
+		// missing files can't be ruled out
+		return exitMissing
+	}
+
+	return exitSuccess
+}
+
+//Print writes the report in a human readable form
+func (report *RunReport) Print(w io.Writer) {
+	fmt.Fprintln(w, "command:", report.Parameters["command"], report.Parameters["path"])
+	fmt.Fprintln(w, "started:", report.Started.Format(time.RFC3339), "took:", secondsDuration(report.Seconds).Round(time.Second))
+
+	names := make([]string, 0, len(report.Parameters))
+	for name := range report.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "parameters:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s=%s\n", name, report.Parameters[name])
+	}
+
+	report.Write.Print(w, "write")
+	report.Read.Print(w, "read")
+	if report.Verify != nil {
+		report.Verify.Print(w)
+	}
+	if report.Capacity != nil {
+		report.Capacity.Print(w)
+	}
+	if report.Metadata != nil {
+		report.Metadata.Print(w)
+	}
+	if report.Clean != nil {
+		report.Clean.Print(w)
+	}
+	if report.BurnIn != nil {
+		report.BurnIn.Print(w)
+	}
+	if len(report.Bench) > 0 {
+		fmt.Fprintln(w, "bench:")
+		printBench(w, report.Bench)
+	}
+	report.PrintErrors(w)
+	fmt.Fprintln(w, "verdict:", report.Verdict)
+}
+
+//WriteFile writes the report as JSON to path
+func (report *RunReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
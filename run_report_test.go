@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRunReport(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("size", "1GB", "")
+
+	report := NewRunReport(flags, "/data")
+	if report.Parameters["size"] != "1GB" || report.Parameters["path"] != "/data" {
+		t.Error("unexpected parameters", report.Parameters)
+	}
+}
+
+func TestRunReportVerdict(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	report := NewRunReport(flags, "/data")
+	report.Finish(nil, nil, NewVerifyResult(), &CapacityResult{Claimed: 5, Actual: 5}, nil)
+	if report.Verdict != verdictPass {
+		t.Error("expected pass, got", report.Verdict)
+	}
+
+	verify := NewVerifyResult()
+	verify.addSeedMismatch(&TempFile{path: "a"}, 3)
+	report.Finish(nil, nil, verify, nil, nil)
+	if report.Verdict != verdictFail {
+		t.Error("expected fail, got", report.Verdict)
+	}
+
+	report.Finish(nil, nil, NewVerifyResult(), &CapacityResult{Claimed: 5, Actual: 4}, nil)
+	if report.Verdict != verdictFail {
+		t.Error("expected fail, got", report.Verdict)
+	}
+
+	verify = NewVerifyResult()
+	verify.Incomplete = true
+	report.Finish(nil, nil, verify, nil, nil)
+	if report.Verdict != verdictFail || report.ExitCode() != exitMissing {
+		t.Error("expected an incomplete verification to fail, got", report.Verdict, report.ExitCode())
+	}
+
+	report.AddError(nil)
+	report.AddError(errors.New("boom"))
+	report.Finish(nil, nil, NewVerifyResult(), nil, nil)
+	if report.Verdict != verdictError || len(report.Errors) != 1 {
+		t.Error("expected error, got", report.Verdict, report.Errors)
+	}
+}
+
+func TestRunReportWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeStats := NewIOStats("write", nil)
+	writeStats.Record(10, time.Second)
+
+	report := NewRunReport(flag.NewFlagSet("test", flag.ContinueOnError), "/data")
+	report.Finish(writeStats, NewIOStats("read", nil), nil, nil, nil)
+
+	path := filepath.Join(dir, "report.json")
+	if err := report.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := make(map[string]interface{})
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed["verdict"] != verdictPass || parsed["write"] == nil || parsed["read"] != nil {
+		t.Error("unexpected report", string(data))
+	}
+}
+
+func TestLoadRunReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	missing := NewVerifyResult()
+	missing.Missing = append(missing.Missing, &reportFile{Path: "a", Size: 1})
+	report := NewRunReport(flag.NewFlagSet("test", flag.ContinueOnError), "/data")
+	report.AddError(newFileError(errCategoryRead, "b", errors.New("boom")))
+	report.Finish(nil, nil, missing, nil, nil)
+
+	path := filepath.Join(dir, "report.json")
+	if err := report.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadRunReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Verdict != verdictError || loaded.ErrorCount() != 1 || loaded.ExitCode() != report.ExitCode() || len(loaded.Verify.Missing) != 1 {
+		t.Error("unexpected report", loaded)
+	}
+
+	var printed strings.Builder
+	loaded.Print(&printed)
+	if !strings.Contains(printed.String(), "verdict: error") || !strings.Contains(printed.String(), "b: boom") {
+		t.Error("unexpected", printed.String())
+	}
+
+	ioutil.WriteFile(path, []byte("not json"), 0644)
+	if _, err := LoadRunReport(path); err == nil {
+		t.Error("expected error for a file other than a report")
+	}
+}
+
+func TestRunReportExitCode(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	report := NewRunReport(flags, "/data")
+	report.Finish(nil, nil, NewVerifyResult(), nil, nil)
+	if code := report.ExitCode(); code != exitSuccess {
+		t.Error("expected success, got", code)
+	}
+
+	missing := NewVerifyResult()
+	missing.Missing = append(missing.Missing, &reportFile{Path: "a"})
+	report.Finish(nil, nil, missing, nil, nil)
+	if code := report.ExitCode(); code != exitMissing {
+		t.Error("expected missing, got", code)
+	}
+
+	missing.addSeedMismatch(&TempFile{path: "b"}, 0)
+	report.Finish(nil, nil, missing, nil, nil)
+	if code := report.ExitCode(); code != exitMismatch {
+		t.Error("expected mismatch, got", code)
+	}
+
+	report.Finish(nil, nil, nil, &CapacityResult{Claimed: 5, Actual: 4}, nil)
+	if code := report.ExitCode(); code != exitMismatch {
+		t.Error("expected mismatch, got", code)
+	}
+
+	report.Finish(nil, nil, nil, nil, &MetadataResult{Created: 5, SizeMismatches: 1})
+	if code := report.ExitCode(); code != exitMismatch || report.Verdict != verdictFail {
+		t.Error("expected mismatch, got", code, report.Verdict)
+	}
+
+	report.AddError(errors.New("boom"))
+	report.Finish(nil, nil, NewVerifyResult(), nil, nil)
+	if code := report.ExitCode(); code != exitIOError {
+		t.Error("expected I/O error, got", code)
+	}
+
+	report.AddError(context.Canceled)
+	report.Finish(nil, nil, NewVerifyResult(), nil, nil)
+	if code := report.ExitCode(); code != exitCancelled || report.Verdict != verdictCancelled {
+		t.Error("expected cancelled, got", code, report.Verdict)
+	}
+}
+
+func TestRunReportErrorCategories(t *testing.T) {
+	report := NewRunReport(flag.NewFlagSet("test", flag.ContinueOnError), "/data")
+	report.AddError(newFileError(errCategoryRead, "/data/a", errors.New("bad sector")))
+	report.AddError(newFileError(errCategoryRead, "/data/b", errors.New("bad sector")))
+	report.AddError(newFileError(errCategoryWalk, "/data/c", errors.New("permission denied")))
+	report.AddError(errors.New("boom"))
+
+	if report.ErrorCount() != 4 {
+		t.Error("expected 4 errors, got", report.ErrorCount())
+	}
+	if read := report.Errors[errCategoryRead]; len(read) != 2 || read[1].Path != "/data/b" || read[1].Error != "bad sector" {
+		t.Error("unexpected read errors", read)
+	}
+	if len(report.Errors[errCategoryWalk]) != 1 || len(report.Errors[errCategoryOther]) != 1 {
+		t.Error("unexpected errors", report.Errors)
+	}
+
+	var out strings.Builder
+	report.PrintErrors(&out)
+	for _, line := range []string{"4 errors:", "  read: 2", "    /data/b: bad sector", "  other: 1", "    boom"} {
+		if !strings.Contains(out.String(), line) {
+			t.Error("expected", line, "in", out.String())
+		}
+	}
+}
+
+func TestRunReportMerge(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	report := NewRunReport(flags, "/data")
+	report.AddError(newFileError(errCategoryRead, "a", errors.New("boom")))
+
+	pass := NewRunReport(flags, "/data")
+	pass.AddError(newFileError(errCategoryRead, "b", errors.New("boom")))
+	pass.AddError(context.Canceled)
+	report.merge(pass)
+
+	report.Finish(nil, nil, nil, nil, nil)
+	if report.ErrorCount() != 3 || len(report.Errors[errCategoryRead]) != 2 || report.Verdict != verdictCancelled {
+		t.Error("unexpected merge", report.Errors, report.Verdict)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"path/filepath"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+const seededBlockSize = 64 * sizeFormat.KB
+
+type (
+	//SeededContent deterministically derives file content from a run seed and the file's path,
+	//so any offset of the file can be regenerated without storing anything
+	SeededContent struct {
+		seed     int64
+		key      string
+		blockIdx int64
+		block    []byte
+	}
+)
+
+//NewSeededContent constructor. key identifies the file within the volume, see seededKey
+func NewSeededContent(seed int64, key string) *SeededContent {
+	return &SeededContent{
+		seed:     seed,
+		key:      key,
+		blockIdx: -1,
+		block:    make([]byte, seededBlockSize),
+	}
+}
+
+//seededKey returns the volume-relative path of the file, so the volume can be mounted elsewhere for verification
+func seededKey(volumeRoot string, path string) string {
+	rel, err := filepath.Rel(volumeRoot, path)
+	if err != nil {
+		rel = path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+//Fill fills buf with the content of the file starting at offset
+func (sc *SeededContent) Fill(buf []byte, offset int64) {
+	for len(buf) > 0 {
+		blockIdx := offset / seededBlockSize
+		if blockIdx != sc.blockIdx {
+			sc.generateBlock(blockIdx)
+		}
+
+		n := copy(buf, sc.block[offset-blockIdx*seededBlockSize:])
+		buf = buf[n:]
+		offset += int64(n)
+	}
+}
+
+func (sc *SeededContent) generateBlock(blockIdx int64) {
+	h := fnv.New64a()
+	var num [8]byte
+	binary.LittleEndian.PutUint64(num[:], uint64(sc.seed))
+	h.Write(num[:])
+	h.Write([]byte(sc.key))
+	binary.LittleEndian.PutUint64(num[:], uint64(blockIdx))
+	h.Write(num[:])
+
+	rand.New(rand.NewSource(int64(h.Sum64()))).Read(sc.block)
+	sc.blockIdx = blockIdx
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSeededContentFill(t *testing.T) {
+	size := 3*seededBlockSize + 17
+	whole := make([]byte, size)
+	NewSeededContent(42, "file_0.tmp").Fill(whole, 0)
+
+	// any offset can be regenerated on its own
+	offset := int64(seededBlockSize - 5)
+	part := make([]byte, seededBlockSize+10)
+	NewSeededContent(42, "file_0.tmp").Fill(part, offset)
+	if !bytes.Equal(part, whole[offset:offset+int64(len(part))]) {
+		t.Error("content at offset", offset, "differs from the whole file content")
+	}
+
+	other := make([]byte, size)
+	NewSeededContent(42, "file_1.tmp").Fill(other, 0)
+	if bytes.Equal(whole, other) {
+		t.Error("expected different files to have different content")
+	}
+
+	NewSeededContent(43, "file_0.tmp").Fill(other, 0)
+	if bytes.Equal(whole, other) {
+		t.Error("expected different seeds to produce different content")
+	}
+}
+
+func TestSeededKey(t *testing.T) {
+	if key := seededKey("/mnt/a", "/mnt/a/subfolder_0.tmp/file_0.tmp"); key != "subfolder_0.tmp/file_0.tmp" {
+		t.Error("unexpected key", key)
+	}
+}
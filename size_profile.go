@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+//-sizes values, besides the preset names
+const (
+	sizesDefault   = "default"
+	sizesFixed     = "fixed="
+	sizesClasses   = "classes="
+	sizesHistogram = "histogram="
+	sizesFile      = ".json"
+)
+
+type (
+	//sizeBucket is a range of file sizes, picked with the probability of its weight among the buckets of its class
+	sizeBucket struct {
+		tempFileSizeConstraint
+		weight float64
+	}
+
+	//sizeProfileClass generates share (0-1] of the volume with files of the sizes of its buckets
+	sizeProfileClass struct {
+		share   float64
+		buckets []sizeBucket
+	}
+
+	//sizeProfile is the distribution of the generated file sizes, set by "size_profile" in ctx
+	sizeProfile struct {
+		classes []sizeProfileClass
+	}
+
+	//sizeProfileFile is the JSON config file form of a profile: one of the fields is set
+	sizeProfileFile struct {
+		Preset    string                `json:"preset"`
+		Fixed     string                `json:"fixed"`
+		Classes   []sizeProfileFileItem `json:"classes"`
+		Histogram []sizeProfileFileItem `json:"histogram"`
+	}
+
+	sizeProfileFileItem struct {
+		Min string `json:"min"`
+		Max string `json:"max"`
+		// percent of the volume for classes, any relative weight for histogram buckets
+		Share  float64 `json:"share"`
+		Weight float64 `json:"weight"`
+	}
+)
+
+//sizePresets are the named -sizes profiles. default is the original small/medium/large mix
+var sizePresets = map[string]func() *sizeProfile{
+	sizesDefault: func() *sizeProfile {
+		return &sizeProfile{classes: []sizeProfileClass{
+			{share: .5, buckets: []sizeBucket{{largeFileSizeConstraint, 1}}},
+			{share: .35, buckets: []sizeBucket{{medFileSizeConstraint, 1}}},
+			{share: .15, buckets: []sizeBucket{{smallFileSizeConstraint, 1}}},
+		}}
+	},
+	// thumbnails, camera JPEGs and RAW files
+	"photos": func() *sizeProfile {
+		return histogramProfile(
+			sizeBucket{tempFileSizeConstraint{10 * sizeFormat.KB, 500 * sizeFormat.KB}, 20},
+			sizeBucket{tempFileSizeConstraint{2 * sizeFormat.MB, 12 * sizeFormat.MB}, 60},
+			sizeBucket{tempFileSizeConstraint{20 * sizeFormat.MB, 80 * sizeFormat.MB}, 20},
+		)
+	},
+	// mostly small sources, some binaries
+	"source": func() *sizeProfile {
+		return histogramProfile(
+			sizeBucket{tempFileSizeConstraint{100 * sizeFormat.B, 4 * sizeFormat.KB}, 50},
+			sizeBucket{tempFileSizeConstraint{4 * sizeFormat.KB, 64 * sizeFormat.KB}, 40},
+			sizeBucket{tempFileSizeConstraint{64 * sizeFormat.KB, 1 * sizeFormat.MB}, 9},
+			sizeBucket{tempFileSizeConstraint{1 * sizeFormat.MB, 50 * sizeFormat.MB}, 1},
+		)
+	},
+	// clips and full length videos
+	"video": func() *sizeProfile {
+		return &sizeProfile{classes: []sizeProfileClass{
+			{share: .7, buckets: []sizeBucket{{tempFileSizeConstraint{4 * sizeFormat.GB, 50 * sizeFormat.GB}, 1}}},
+			{share: .3, buckets: []sizeBucket{{tempFileSizeConstraint{100 * sizeFormat.MB, 4 * sizeFormat.GB}, 1}}},
+		}}
+	},
+	// 1GB data segments and 16MB write ahead log files
+	"database": func() *sizeProfile {
+		return &sizeProfile{classes: []sizeProfileClass{
+			{share: .85, buckets: []sizeBucket{{tempFileSizeConstraint{sizeFormat.GB, sizeFormat.GB}, 1}}},
+			{share: .15, buckets: []sizeBucket{{tempFileSizeConstraint{16 * sizeFormat.MB, 16 * sizeFormat.MB}, 1}}},
+		}}
+	},
+}
+
+func histogramProfile(buckets ...sizeBucket) *sizeProfile {
+	return &sizeProfile{classes: []sizeProfileClass{{share: 1, buckets: buckets}}}
+}
+
+//sizePresetNames lists the presets in a stable order, for the usage
+func sizePresetNames() []string {
+	names := make([]string, 0, len(sizePresets))
+	for name := range sizePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//parseSizeProfile parses -sizes: a preset name, fixed=SIZE, classes=MIN-MAX:SHARE%,... (shares of the volume),
+//histogram=MIN-MAX:WEIGHT,... (relative number of files) or the path of a .json file with one of these
+func parseSizeProfile(spec string) (*sizeProfile, error) {
+	spec = strings.TrimSpace(spec)
+	var profile *sizeProfile
+	var err error
+	switch {
+	case sizePresets[spec] != nil:
+		profile = sizePresets[spec]()
+	case strings.HasPrefix(spec, sizesFixed):
+		var size int64
+		size, err = toNum(strings.TrimPrefix(spec, sizesFixed))
+		profile = histogramProfile(sizeBucket{tempFileSizeConstraint{size, size}, 1})
+	case strings.HasPrefix(spec, sizesClasses):
+		profile, err = parseSizeClasses(strings.Split(strings.TrimPrefix(spec, sizesClasses), ","))
+	case strings.HasPrefix(spec, sizesHistogram):
+		profile, err = parseSizeHistogram(strings.Split(strings.TrimPrefix(spec, sizesHistogram), ","))
+	case strings.HasSuffix(spec, sizesFile):
+		profile, err = loadSizeProfile(spec)
+	default:
+		return nil, fmt.Errorf("unknown size profile %s", spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad size profile %s: %v", spec, err)
+	}
+
+	if err := profile.check(); err != nil {
+		return nil, fmt.Errorf("bad size profile %s: %v", spec, err)
+	}
+
+	return profile, nil
+}
+
+func parseSizeClasses(items []string) (*sizeProfile, error) {
+	profile := &sizeProfile{}
+	for _, item := range items {
+		constraint, share, err := parseSizeItem(strings.TrimSuffix(item, "%"))
+		if err != nil {
+			return nil, err
+		}
+		profile.classes = append(profile.classes, sizeProfileClass{share: share / 100, buckets: []sizeBucket{{constraint, 1}}})
+	}
+
+	return profile, nil
+}
+
+func parseSizeHistogram(items []string) (*sizeProfile, error) {
+	var buckets []sizeBucket
+	for _, item := range items {
+		constraint, weight, err := parseSizeItem(item)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, sizeBucket{constraint, weight})
+	}
+
+	return histogramProfile(buckets...), nil
+}
+
+//parseSizeItem parses MIN-MAX:NUMBER, or SIZE:NUMBER for a single size
+func parseSizeItem(item string) (tempFileSizeConstraint, float64, error) {
+	var constraint tempFileSizeConstraint
+	colon := strings.LastIndex(item, ":")
+	if colon < 0 {
+		return constraint, 0, fmt.Errorf("%s: expected MIN-MAX:NUMBER", item)
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(item[colon+1:]), 64)
+	if err != nil {
+		return constraint, 0, fmt.Errorf("%s: %v", item, err)
+	}
+
+	constraint, err = parseSizeRange(item[:colon], "")
+	return constraint, number, err
+}
+
+//parseSizeRange parses min and max, or MIN-MAX from min if max is empty
+func parseSizeRange(min, max string) (tempFileSizeConstraint, error) {
+	var constraint tempFileSizeConstraint
+	if max == "" {
+		max = min
+		if dash := strings.Index(min, "-"); dash >= 0 {
+			min, max = min[:dash], min[dash+1:]
+		}
+	}
+
+	var err error
+	if constraint.min, err = toNum(strings.TrimSpace(min)); err != nil {
+		return constraint, err
+	}
+	if constraint.max, err = toNum(strings.TrimSpace(max)); err != nil {
+		return constraint, err
+	}
+
+	return constraint, nil
+}
+
+//loadSizeProfile reads a profile from a JSON config file
+func loadSizeProfile(path string) (*sizeProfile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config sizeProfileFile
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case config.Preset != "" && sizePresets[config.Preset] != nil:
+		return sizePresets[config.Preset](), nil
+	case config.Preset != "":
+		return nil, fmt.Errorf("unknown preset %s", config.Preset)
+	case config.Fixed != "":
+		size, err := toNum(config.Fixed)
+		return histogramProfile(sizeBucket{tempFileSizeConstraint{size, size}, 1}), err
+	}
+
+	profile := &sizeProfile{}
+	for _, item := range config.Classes {
+		constraint, err := parseSizeRange(item.Min, item.Max)
+		if err != nil {
+			return nil, err
+		}
+		profile.classes = append(profile.classes, sizeProfileClass{share: item.Share / 100, buckets: []sizeBucket{{constraint, 1}}})
+	}
+
+	var buckets []sizeBucket
+	for _, item := range config.Histogram {
+		constraint, err := parseSizeRange(item.Min, item.Max)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, sizeBucket{constraint, item.Weight})
+	}
+	if len(buckets) > 0 {
+		if len(profile.classes) > 0 {
+			return nil, fmt.Errorf("either classes or histogram, not both")
+		}
+		profile = histogramProfile(buckets...)
+	}
+
+	return profile, nil
+}
+
+//check validates the ranges, weights and that the class shares add up to 100%
+func (profile *sizeProfile) check() error {
+	if len(profile.classes) == 0 {
+		return fmt.Errorf("no size classes")
+	}
+
+	total := 0.
+	for _, class := range profile.classes {
+		if class.share <= 0 {
+			return fmt.Errorf("share must be positive")
+		}
+		total += class.share
+
+		for _, bucket := range class.buckets {
+			if bucket.min <= 0 || bucket.max < bucket.min {
+				return fmt.Errorf("bad size range %d-%d", bucket.min, bucket.max)
+			}
+			if bucket.weight <= 0 {
+				return fmt.Errorf("weight must be positive")
+			}
+		}
+	}
+
+	if total < .999 || total > 1.001 {
+		return fmt.Errorf("shares add up to %.1f%% instead of 100%%", total*100)
+	}
+
+	return nil
+}
+
+func getSizeProfile(ctx context.Context) *sizeProfile {
+	if profile, ok := ctx.Value("size_profile").(*sizeProfile); ok && profile != nil {
+		return profile
+	}
+
+	return sizePresets[sizesDefault]()
+}
+
+//sizeGenerators returns a generator of file sizes per class, the largest files first.
+//Each class generates its share of volume. The share of the classes whose smallest files do not fit into it is
+//spread over the others, e.g. a 1GB volume gets no 10GB files, so it is filled with the smaller classes only
+func (profile *sizeProfile) sizeGenerators(volume int64) []func() int64 {
+	classes := append([]sizeProfileClass(nil), profile.classes...)
+	sort.SliceStable(classes, func(i, j int) bool { return classes[i].largest() > classes[j].largest() })
+
+	for dropped := true; dropped; {
+		dropped = false
+		total := 0.
+		for _, class := range classes {
+			total += class.share
+		}
+
+		fitting := classes[:0]
+		for _, class := range classes {
+			if class.smallest() > int64(float64(volume)*class.share/total) {
+				dropped = true
+				continue
+			}
+			fitting = append(fitting, class)
+		}
+		classes = fitting
+	}
+
+	total := 0.
+	for _, class := range classes {
+		total += class.share
+	}
+
+	generators := make([]func() int64, 0, len(classes))
+	for i := range classes {
+		class := classes[i]
+		budget := int64(float64(volume) * class.share / total)
+		generators = append(generators, func() int64 {
+			bucket := class.pick()
+			size := getRandomFileSizeFunc(&bucket.tempFileSizeConstraint, budget)()
+			budget -= size
+			return size
+		})
+	}
+
+	return generators
+}
+
+//statClasses returns the distinct file size ranges of the profile, smallest first, to report the throughput per range
+func (profile *sizeProfile) statClasses() []tempFileSizeConstraint {
+	ranges := make([]tempFileSizeConstraint, 0)
+	seen := make(map[tempFileSizeConstraint]bool)
+	for _, class := range profile.classes {
+		for _, bucket := range class.buckets {
+			if !seen[bucket.tempFileSizeConstraint] {
+				seen[bucket.tempFileSizeConstraint] = true
+				ranges = append(ranges, bucket.tempFileSizeConstraint)
+			}
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].min != ranges[j].min {
+			return ranges[i].min < ranges[j].min
+		}
+		return ranges[i].max < ranges[j].max
+	})
+
+	return ranges
+}
+
+//pick chooses one of the buckets by their weights
+func (class *sizeProfileClass) pick() *sizeBucket {
+	total := 0.
+	for _, bucket := range class.buckets {
+		total += bucket.weight
+	}
+
+	point := rand.Float64() * total
+	for i := range class.buckets {
+		point -= class.buckets[i].weight
+		if point < 0 {
+			return &class.buckets[i]
+		}
+	}
+
+	return &class.buckets[len(class.buckets)-1]
+}
+
+func (class *sizeProfileClass) smallest() int64 {
+	smallest := class.buckets[0].min
+	for _, bucket := range class.buckets {
+		if bucket.min < smallest {
+			smallest = bucket.min
+		}
+	}
+
+	return smallest
+}
+
+func (class *sizeProfileClass) largest() int64 {
+	largest := class.buckets[0].max
+	for _, bucket := range class.buckets {
+		if bucket.max > largest {
+			largest = bucket.max
+		}
+	}
+
+	return largest
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+func TestParseSizeProfile(t *testing.T) {
+	for _, name := range sizePresetNames() {
+		if _, err := parseSizeProfile(name); err != nil {
+			t.Error(name, err)
+		}
+	}
+
+	profile, err := parseSizeProfile("fixed=4KB")
+	if err != nil || len(profile.classes) != 1 || profile.classes[0].buckets[0].min != 4*sizeFormat.KB || profile.classes[0].buckets[0].max != 4*sizeFormat.KB {
+		t.Error("unexpected", profile, err)
+	}
+
+	profile, err = parseSizeProfile("classes=1MB-5MB:60%,100KB-200KB:40%")
+	if err != nil || len(profile.classes) != 2 || profile.classes[1].share != .4 || profile.classes[1].buckets[0].max != 200*sizeFormat.KB {
+		t.Error("unexpected", profile, err)
+	}
+
+	profile, err = parseSizeProfile("histogram=1KB-4KB:3,1MB:1")
+	if err != nil || len(profile.classes) != 1 || len(profile.classes[0].buckets) != 2 || profile.classes[0].buckets[1].min != sizeFormat.MB {
+		t.Error("unexpected", profile, err)
+	}
+
+	for _, bad := range []string{"bogus", "fixed=x", "classes=1MB-5MB:60%", "classes=5MB-1MB:100%", "histogram=1KB-4KB", "histogram=1KB-4KB:0", "/non-existent.json"} {
+		if _, err := parseSizeProfile(bad); err == nil {
+			t.Error("expected error for", bad)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "sizes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "profile.json")
+	ioutil.WriteFile(path, []byte(`{"classes":[{"min":"1MB","max":"5MB","share":60},{"min":"100KB","max":"200KB","share":40}]}`), 0600)
+	profile, err = parseSizeProfile(path)
+	if err != nil || len(profile.classes) != 2 || profile.classes[0].share != .6 {
+		t.Error("unexpected", profile, err)
+	}
+}
+
+func TestSizeGenerators(t *testing.T) {
+	volume := int64(100 * sizeFormat.MB)
+	profile, _ := parseSizeProfile("classes=1MB-5MB:60%,100KB-200KB:40%")
+
+	generators := profile.sizeGenerators(volume)
+	if len(generators) != 2 {
+		t.Fatal("expected 2 generators, got", len(generators))
+	}
+
+	// every class generates about its share of the volume, within its size range
+	for i, expected := range []struct{ min, max, total int64 }{
+		{sizeFormat.MB, 5 * sizeFormat.MB, 60 * sizeFormat.MB},
+		{100 * sizeFormat.KB, 200 * sizeFormat.KB, 40 * sizeFormat.MB},
+	} {
+		total := int64(0)
+		for size := generators[i](); size != 0; size = generators[i]() {
+			if size < expected.min || size > expected.max {
+				t.Error("size", size, "out of", expected.min, expected.max)
+			}
+			total += size
+		}
+
+		if total > expected.total || total < expected.total-expected.min {
+			t.Error("expected about", expected.total, "got", total)
+		}
+	}
+
+	// no 10GB files in 1GB: the small and medium files share it
+	generators = sizePresets[sizesDefault]().sizeGenerators(sizeFormat.GB)
+	if len(generators) != 2 {
+		t.Error("expected 2 generators, got", len(generators))
+	}
+
+	generators = histogramProfile(sizeBucket{tempFileSizeConstraint{4 * sizeFormat.KB, 4 * sizeFormat.KB}, 1}).sizeGenerators(10 * sizeFormat.KB)
+	for i, expected := range []int64{4 * sizeFormat.KB, 4 * sizeFormat.KB, 0} {
+		if size := generators[0](); size != expected {
+			t.Error(i, "expected", expected, "got", size)
+		}
+	}
+}
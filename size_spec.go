@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+const sizeFree = "free"
+
+//parseSize parses the -size flag. Besides an absolute size like 5.5GB it accepts sizes relative
+//to the free space of the filesystem at rootPath: "free", "95%" (of the free space) and "free-2GB".
+//"free" and percentages near 100 leave capacityReserve to the filesystem, like the capacity check does
+func parseSize(spec string, rootPath string) (int64, error) {
+	spec = strings.TrimSpace(spec)
+	relative := strings.HasPrefix(spec, sizeFree) || strings.HasSuffix(spec, "%")
+	if !relative {
+		return toNum(spec)
+	}
+
+	_, free, err := diskSpace(rootPath)
+	if err != nil {
+		return 0, fmt.Errorf("could not get free space at %s: %v", rootPath, err)
+	}
+
+	// the filesystem needs room of its own: block rounding and metadata take more than the file sizes add up to
+	usable := free - capacityReserve
+
+	switch {
+	case spec == sizeFree:
+		if usable <= 0 {
+			return 0, fmt.Errorf("not enough free space at %s: %s", rootPath, sizeFormat.ToString(free))
+		}
+
+		return usable, nil
+	case strings.HasSuffix(spec, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(spec, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, fmt.Errorf("bad percentage of free space %s", spec)
+		}
+
+		size := int64(float64(free) * percent / 100)
+		if size > usable {
+			size = usable
+		}
+		return size, nil
+	case strings.HasPrefix(spec, sizeFree+"-"):
+		reserve := strings.TrimPrefix(spec, sizeFree+"-")
+		reserveBytes, err := toNum(reserve)
+		if err != nil {
+			return 0, err
+		}
+
+		return free - reserveBytes, nil
+	}
+
+	return 0, fmt.Errorf("bad size %s", spec)
+}
+
+//toNum guards sizeFormat.ToNum, which panics on values shorter than a unit
+func toNum(value string) (int64, error) {
+	if len(value) < 2 {
+		return 0, fmt.Errorf("bad size %s", value)
+	}
+
+	return sizeFormat.ToNum(&value)
+}
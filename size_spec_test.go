@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+func TestParseSize(t *testing.T) {
+	if size, err := parseSize("5.5GB", "/non-existent"); err != nil || size != int64(5.5*float64(sizeFormat.GB)) {
+		t.Error("unexpected", size, err)
+	}
+
+	_, free, err := diskSpace(".")
+	if err != nil {
+		t.Skip("disk space is not available", err)
+	}
+
+	// free space changes between calls, so allow some slack
+	near := func(actual, expected int64) bool {
+		diff := actual - expected
+		return diff < 100*sizeFormat.MB && diff > -100*sizeFormat.MB
+	}
+
+	if size, err := parseSize("free", "."); err != nil || !near(size, free-capacityReserve) || size > free-capacityReserve {
+		t.Error("expected", free-capacityReserve, "got", size, err)
+	}
+
+	if size, err := parseSize("100%", "."); err != nil || size > free-capacityReserve {
+		t.Error("expected the reserve to be left, got", size, err)
+	}
+
+	if size, err := parseSize("50%", "."); err != nil || !near(size, free/2) {
+		t.Error("expected", free/2, "got", size, err)
+	}
+
+	if size, err := parseSize("free-1MB", "."); err != nil || !near(size, free-sizeFormat.MB) {
+		t.Error("expected", free-sizeFormat.MB, "got", size, err)
+	}
+
+	for _, bad := range []string{"150%", "x%", "free-x", "freedom"} {
+		if _, err := parseSize(bad, "."); err == nil {
+			t.Error("expected error for", bad)
+		}
+	}
+
+	if _, err := parseSize("free", "/non-existent"); err == nil {
+		t.Error("expected error on missing path")
+	}
+}
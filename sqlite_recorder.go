@@ -1,17 +1,98 @@
 package main
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
+	"time"
+
+	// registers the sqlite3 driver with database/sql
+	_ "github.com/mattn/go-sqlite3"
 )
 
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS files (
+	path        TEXT PRIMARY KEY,
+	size        INTEGER NOT NULL,
+	hash        TEXT NOT NULL,
+	blocks      BLOB,
+	marked      INTEGER NOT NULL DEFAULT 0,
+	recorded_at INTEGER NOT NULL,
+	marked_at   INTEGER
+);
+CREATE INDEX IF NOT EXISTS files_hash ON files(hash, marked);
+CREATE INDEX IF NOT EXISTS files_marked ON files(marked);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+//sqliteMetaHash is the meta key of the hash algorithm the files were recorded with
+const sqliteMetaHash = "hash"
+
 type (
+	//SqliteRecorder holding records in an on-disk SQLite database
 	SqliteRecorder struct {
+		db *sql.DB
 	}
 )
 
-//NewSqlLiteRecorder constructor
-func NewSqlLiteRecorder() *SqliteRecorder {
-	return &SqliteRecorder{}
+//NewSqlLiteRecorder constructor. Opens (or creates) the database at dbPath
+func NewSqlLiteRecorder(dbPath string) (*SqliteRecorder, error) {
+	if len(dbPath) == 0 {
+		return nil, errors.New("sqlite db path can't be empty")
+	}
+
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000", dbPath)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows a single writer anyway: serialize in the pool rather than fail with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize %s: %v", dbPath, err)
+	}
+
+	return &SqliteRecorder{db: db}, nil
+}
+
+//Truncate removes all the records and their meta data, e.g. before a fresh generation
+func (rec SqliteRecorder) Truncate() error {
+	_, err := rec.db.Exec("DELETE FROM files; DELETE FROM meta")
+	return err
+}
+
+//SetMeta stores value under key, along with the records
+func (rec SqliteRecorder) SetMeta(key string, value string) error {
+	_, err := rec.db.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)", key, value)
+	return err
+}
+
+//GetMeta returns the value stored under key, empty if there is none
+func (rec SqliteRecorder) GetMeta(key string) (string, error) {
+	var value string
+	err := rec.db.QueryRow("SELECT value FROM meta WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return value, err
+}
+
+//UnmarkAll resets verification marks, so records can be verified again
+func (rec SqliteRecorder) UnmarkAll() error {
+	_, err := rec.db.Exec("UPDATE files SET marked = 0, marked_at = NULL")
+	return err
+}
+
+//Close releases the underlying database
+func (rec SqliteRecorder) Close() error {
+	return rec.db.Close()
 }
 
 //RecordFile implements IFileRecorder
@@ -20,9 +101,12 @@ func (rec SqliteRecorder) RecordFile(file *TempFile) error {
 		return errors.New("temp file can't be null")
 	}
 
-	//TODO: implement
+	_, err := rec.db.Exec(
+		"INSERT OR REPLACE INTO files (path, size, hash, blocks, marked, recorded_at) VALUES (?, ?, ?, ?, 0, ?)",
+		file.path, file.size, file.hash, encodeBlocks(file.blocks), time.Now().Unix(),
+	)
 
-	return nil
+	return err
 }
 
 //VerifyFileExits implements IFileRecorder
@@ -31,8 +115,13 @@ func (rec SqliteRecorder) VerifyFileExits(file *TempFile) (bool, error) {
 		return false, errors.New("temp file can't be null")
 	}
 
-	//TODO: implement
-	return false, nil
+	var found int
+	err := rec.db.QueryRow("SELECT 1 FROM files WHERE hash = ? LIMIT 1", file.hash).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	return err == nil, err
 }
 
 //MarkFileExits implements IFileRecorder
@@ -41,28 +130,104 @@ func (rec SqliteRecorder) MarkFileExits(file *TempFile) (bool, error) {
 		return false, errors.New("temp file can't be null")
 	}
 
-	//TODO implement
-	return false, nil
+	// files with equal content share a hash: mark one of them per call
+	res, err := rec.db.Exec(
+		"UPDATE files SET marked = 1, marked_at = ? WHERE rowid = (SELECT rowid FROM files WHERE hash = ? AND marked = 0 LIMIT 1)",
+		time.Now().Unix(), file.hash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected > 0 {
+		return true, nil
+	}
+
+	exists, err := rec.VerifyFileExits(file)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, fmt.Errorf("%s does not exist", file.hash)
+	}
+
+	fmt.Println("WARN", file.hash, "has already been marked")
+	return true, nil
+}
+
+//FindFileByPath implements IFileRecorder
+func (rec SqliteRecorder) FindFileByPath(path string) (*TempFile, error) {
+	file := TempFile{path: path}
+	var blocks []byte
+	err := rec.db.QueryRow("SELECT size, hash, blocks FROM files WHERE path = ?", path).Scan(&file.size, &file.hash, &blocks)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.blocks = decodeBlocks(blocks)
+
+	return &file, nil
+}
+
+//MarkPathExists implements IFileRecorder
+func (rec SqliteRecorder) MarkPathExists(path string) (bool, error) {
+	res, err := rec.db.Exec("UPDATE files SET marked = 1, marked_at = ? WHERE path = ?", time.Now().Unix(), path)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, fmt.Errorf("%s does not exist", path)
+	}
+
+	return true, nil
 }
 
 //FilesNotCheckedYet implements IFileRecorder
 func (rec SqliteRecorder) FilesNotCheckedYet() ([]*TempFile, error) {
+	rows, err := rec.db.Query("SELECT path, size, hash, blocks FROM files WHERE marked = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	result := make([]*TempFile, 0)
-	// TODO implement
+	for rows.Next() {
+		file := TempFile{}
+		var blocks []byte
+		if err := rows.Scan(&file.path, &file.size, &file.hash, &blocks); err != nil {
+			return nil, err
+		}
+		file.blocks = decodeBlocks(blocks)
+		result = append(result, &file)
+	}
 
-	return result, nil
+	return result, rows.Err()
 }
 
 //GetTotalUnmarked implements IFileRecorder
 func (rec SqliteRecorder) GetTotalUnmarked() (int64, error) {
-	res := int64(0)
-
-	return res, nil
+	return rec.sumSize(false)
 }
 
 //GetTotalMarked implements IFileRecorder
 func (rec SqliteRecorder) GetTotalMarked() (int64, error) {
+	return rec.sumSize(true)
+}
+
+func (rec SqliteRecorder) sumSize(marked bool) (int64, error) {
 	res := int64(0)
+	err := rec.db.QueryRow("SELECT COALESCE(SUM(size), 0) FROM files WHERE marked = ?", marked).Scan(&res)
 
-	return res, nil
+	return res, err
 }
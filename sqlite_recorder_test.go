@@ -0,0 +1,221 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestSqliteRecorder(t *testing.T) (*SqliteRecorder, func()) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := NewSqlLiteRecorder(filepath.Join(dir, "test.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return rec, func() {
+		rec.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewSqlLiteRecorder(t *testing.T) {
+	rec, cleanup := newTestSqliteRecorder(t)
+	defer cleanup()
+
+	if rec == nil {
+		t.Error("expected non nil object")
+	}
+
+	if _, err := NewSqlLiteRecorder(""); err == nil {
+		t.Error("expected error on empty path")
+	}
+}
+
+func TestSqliteRecordFile(t *testing.T) {
+	rec, cleanup := newTestSqliteRecorder(t)
+	defer cleanup()
+
+	if err := rec.RecordFile(nil); err == nil {
+		t.Error("expected error on nil file")
+	}
+
+	f1 := TempFile{path: "a", size: 2, hash: "hash1"}
+	f2 := TempFile{path: "b", size: 3, hash: "hash2"}
+	rec.RecordFile(&f1)
+	rec.RecordFile(&f1)
+	rec.RecordFile(&f2)
+
+	total, err := rec.GetTotalUnmarked()
+	if err != nil || total != 5 {
+		t.Error("expected 5 unmarked bytes, got", total, err)
+	}
+
+	if err := rec.Truncate(); err != nil {
+		t.Error(err)
+	}
+
+	total, err = rec.GetTotalUnmarked()
+	if err != nil || total != 0 {
+		t.Error("expected 0 unmarked bytes after truncate, got", total, err)
+	}
+}
+
+func TestSqliteMeta(t *testing.T) {
+	rec, cleanup := newTestSqliteRecorder(t)
+	defer cleanup()
+
+	if value, err := rec.GetMeta(sqliteMetaHash); value != "" || err != nil {
+		t.Error("expected no value, got", value, err)
+	}
+
+	rec.SetMeta(sqliteMetaHash, hashMD5)
+	rec.SetMeta(sqliteMetaHash, hashXXHash)
+	if value, err := rec.GetMeta(sqliteMetaHash); value != hashXXHash || err != nil {
+		t.Error("expected", hashXXHash, "got", value, err)
+	}
+
+	if err := rec.Truncate(); err != nil {
+		t.Error(err)
+	}
+	if value, err := rec.GetMeta(sqliteMetaHash); value != "" || err != nil {
+		t.Error("expected no value after truncate, got", value, err)
+	}
+}
+
+func TestSqliteVerifyFileExits(t *testing.T) {
+	rec, cleanup := newTestSqliteRecorder(t)
+	defer cleanup()
+
+	f1 := TempFile{path: "a", hash: "hash1"}
+	f2 := TempFile{path: "b", hash: "hash2"}
+	rec.RecordFile(&f1)
+	rec.RecordFile(&f2)
+
+	if exists, err := rec.VerifyFileExits(&f1); !exists || err != nil {
+		t.Error("unexpected", exists, err)
+	}
+
+	if exists, err := rec.VerifyFileExits(nil); exists || err == nil {
+		t.Error("unexpected", exists, err)
+	}
+
+	if exists, err := rec.VerifyFileExits(&TempFile{hash: "hash3"}); exists || err != nil {
+		t.Error("unexpected", exists, err)
+	}
+}
+
+func TestSqliteMarkFileExits(t *testing.T) {
+	rec, cleanup := newTestSqliteRecorder(t)
+	defer cleanup()
+
+	f1 := TempFile{path: "a", size: 2, hash: "hash1"}
+	f2 := TempFile{path: "b", size: 3, hash: "hash1"}
+	rec.RecordFile(&f1)
+	rec.RecordFile(&f2)
+
+	if marked, err := rec.MarkFileExits(&f1); !marked || err != nil {
+		t.Error("unexpected", marked, err)
+	}
+
+	// same content at a different path must be marked separately
+	marked, err := rec.GetTotalMarked()
+	if err != nil || marked != 2 && marked != 3 {
+		t.Error("expected a single file to be marked, got", marked, err)
+	}
+
+	rec.MarkFileExits(&f2)
+	if marked, err := rec.GetTotalMarked(); err != nil || marked != 5 {
+		t.Error("expected 5 marked bytes, got", marked, err)
+	}
+
+	if marked, err := rec.MarkFileExits(&f1); !marked || err != nil {
+		t.Error("unexpected", marked, err)
+	}
+
+	if err := rec.UnmarkAll(); err != nil {
+		t.Error(err)
+	}
+	if marked, err := rec.GetTotalMarked(); err != nil || marked != 0 {
+		t.Error("expected 0 marked bytes after unmark, got", marked, err)
+	}
+
+	if marked, err := rec.MarkFileExits(nil); marked || err == nil {
+		t.Error("unexpected", marked, err)
+	}
+
+	if marked, err := rec.MarkFileExits(&TempFile{hash: "hash3"}); marked || err == nil {
+		t.Error("unexpected", marked, err)
+	}
+}
+
+func TestSqliteFilesNotCheckedYet(t *testing.T) {
+	rec, cleanup := newTestSqliteRecorder(t)
+	defer cleanup()
+
+	f1 := TempFile{path: "a", size: 1, hash: "hash1"}
+	f2 := TempFile{path: "b", size: 1, hash: "hash2", blocks: []uint32{3, 7}}
+	rec.RecordFile(&f1)
+	rec.RecordFile(&f2)
+	rec.MarkFileExits(&f1)
+
+	notChecked, err := rec.FilesNotCheckedYet()
+	if err != nil || len(notChecked) != 1 {
+		t.Fatal("unexpected", err, notChecked)
+	}
+
+	if strings.Compare(notChecked[0].path, f2.path) != 0 || strings.Compare(notChecked[0].hash, f2.hash) != 0 {
+		t.Error("unexpected", notChecked[0], f2)
+	}
+
+	if len(notChecked[0].blocks) != 2 || notChecked[0].blocks[1] != 7 {
+		t.Error("expected block checksums to be loaded, got", notChecked[0].blocks)
+	}
+}
+
+func TestSqliteFindFileByPath(t *testing.T) {
+	rec, cleanup := newTestSqliteRecorder(t)
+	defer cleanup()
+
+	rec.RecordFile(&TempFile{path: "a", size: 3, hash: "hash1", blocks: []uint32{1, 2}})
+
+	found, err := rec.FindFileByPath("a")
+	if err != nil || found == nil {
+		t.Fatal("unexpected", found, err)
+	}
+	if found.size != 3 || found.hash != "hash1" || len(found.blocks) != 2 || found.blocks[1] != 2 {
+		t.Error("unexpected record", found)
+	}
+
+	if found, err := rec.FindFileByPath("b"); found != nil || err != nil {
+		t.Error("unexpected", found, err)
+	}
+}
+
+func TestSqliteMarkPathExists(t *testing.T) {
+	rec, cleanup := newTestSqliteRecorder(t)
+	defer cleanup()
+
+	rec.RecordFile(&TempFile{path: "a", size: 3, hash: "hash1"})
+	rec.RecordFile(&TempFile{path: "b", size: 2, hash: "hash1"})
+
+	if marked, err := rec.MarkPathExists("b"); !marked || err != nil {
+		t.Error("unexpected", marked, err)
+	}
+
+	if marked, err := rec.MarkPathExists("c"); marked || err == nil {
+		t.Error("unexpected", marked, err)
+	}
+
+	notChecked, err := rec.FilesNotCheckedYet()
+	if err != nil || len(notChecked) != 1 || notChecked[0].path != "a" {
+		t.Error("unexpected", err, notChecked)
+	}
+}
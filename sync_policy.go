@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//-fsync values
+const (
+	syncNone  = "none"
+	syncFile  = "file"
+	syncEvery = "every="
+)
+
+type (
+	//syncPolicy is the durability of generated files, set by "sync_policy" in ctx
+	syncPolicy struct {
+		// fsync once the whole file is written
+		perFile bool
+		// fsync every this many bytes written, 0 never
+		everyBytes int64
+		// fsync the directory of a file once the file is created
+		dirs bool
+	}
+)
+
+//parseSyncPolicy parses -fsync: none, file or every=SIZE (e.g. every=64MB, which also syncs at the end of the file)
+func parseSyncPolicy(spec string, dirs bool) (syncPolicy, error) {
+	policy := syncPolicy{dirs: dirs}
+	switch {
+	case spec == syncNone:
+	case spec == syncFile:
+		policy.perFile = true
+	case strings.HasPrefix(spec, syncEvery):
+		every, err := toNum(strings.TrimPrefix(spec, syncEvery))
+		if err != nil || every <= 0 {
+			return policy, fmt.Errorf("bad fsync interval in %s", spec)
+		}
+		policy.perFile = true
+		policy.everyBytes = every
+	default:
+		return policy, fmt.Errorf("unknown fsync policy %s", spec)
+	}
+
+	return policy, nil
+}
+
+func getSyncPolicy(ctx context.Context) syncPolicy {
+	policy, _ := ctx.Value("sync_policy").(syncPolicy)
+	return policy
+}
+
+//syncDir fsyncs the directory at path, so the entries created in it survive a power loss
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
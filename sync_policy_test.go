@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+func TestParseSyncPolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		perFile bool
+		every   int64
+		fail    bool
+	}{
+		{"none", false, 0, false},
+		{"file", true, 0, false},
+		{"every=64MB", true, 64 * sizeFormat.MB, false},
+		{"every=0MB", false, 0, true},
+		{"every=x", false, 0, true},
+		{"always", false, 0, true},
+	}
+
+	for _, test := range tests {
+		policy, err := parseSyncPolicy(test.spec, true)
+		if (err != nil) != test.fail {
+			t.Error("unexpected error for", test.spec, err)
+			continue
+		}
+		if err == nil && (policy.perFile != test.perFile || policy.everyBytes != test.every || !policy.dirs) {
+			t.Error("unexpected policy for", test.spec, policy)
+		}
+	}
+}
+
+func TestGenerateWithSyncPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := syncDir(dir); err != nil {
+		t.Error(err)
+	}
+	if err := syncDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error syncing a missing directory")
+	}
+
+	path := filepath.Join(dir, "a")
+	expected, _, err := GenerateSeeded(context.Background(), 3*sizeFormat.MB+5, path, NewSeededContent(42, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), "sync_policy", syncPolicy{perFile: true, everyBytes: sizeFormat.MB, dirs: true})
+	hash, blocks, err := GenerateSeeded(ctx, 3*sizeFormat.MB+5, path, NewSeededContent(42, "a"))
+	if err != nil || hash != expected || len(blocks) != 4 {
+		t.Error("syncing should not change the content", hash, expected, blocks, err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+//-charset values
+const (
+	charsetASCII   = "ascii"
+	charsetSpaces  = "spaces"
+	charsetUnicode = "unicode"
+
+	filePrefix   = "file_"
+	folderPrefix = "subfolder_"
+	nameSuffix   = ".tmp"
+)
+
+//nameCharsets are the characters names are padded with to -namelen
+var nameCharsets = map[string][]rune{
+	charsetASCII:   []rune("abcdefghijklmnopqrstuvwxyz0123456789"),
+	charsetSpaces:  []rune("abc def ghi jkl mno pqr stu vwx yz "),
+	charsetUnicode: []rune("äöüßéñçøåжщыюяλπΩ中文字日本語한국어עבריתالعربية🙂"),
+}
+
+type (
+	//treeShape is the directory tree files are generated into, set by "tree_shape" in ctx
+	treeShape struct {
+		// levels of subfolders below the root, -1 unlimited
+		depth       int
+		fanOut      int
+		filesPerDir int
+		// length of the names in bytes, as filesystems limit them, 0 the plain file_N.tmp and subfolder_N.tmp
+		nameLen int
+		charset []rune
+	}
+)
+
+func defaultTreeShape() *treeShape {
+	return &treeShape{depth: -1, fanOut: numSubfolders, filesPerDir: numFilesPerFolder, charset: nameCharsets[charsetASCII]}
+}
+
+//newTreeShape validates the tree options. charset pads the names, so it needs nameLen
+func newTreeShape(depth, fanOut, filesPerDir, nameLen int, charset string) (*treeShape, error) {
+	shape := &treeShape{depth: depth, fanOut: fanOut, filesPerDir: filesPerDir, nameLen: nameLen, charset: nameCharsets[charset]}
+	switch {
+	case depth < -1:
+		return nil, fmt.Errorf("bad depth %d", depth)
+	case fanOut < 1 && depth != 0:
+		return nil, fmt.Errorf("bad fan-out %d", fanOut)
+	case filesPerDir < 1:
+		return nil, fmt.Errorf("bad number of files per directory %d", filesPerDir)
+	case nameLen < 0:
+		return nil, fmt.Errorf("bad name length %d", nameLen)
+	case shape.charset == nil:
+		return nil, fmt.Errorf("unknown charset %s", charset)
+	case charset != charsetASCII && nameLen == 0:
+		return nil, fmt.Errorf("charset %s needs a name length", charset)
+	}
+
+	return shape, nil
+}
+
+func getTreeShape(ctx context.Context) *treeShape {
+	if shape, ok := ctx.Value("tree_shape").(*treeShape); ok && shape != nil {
+		return shape
+	}
+
+	return defaultTreeShape()
+}
+
+func (shape *treeShape) fileName(index int) string {
+	return shape.name(filePrefix, index)
+}
+
+func (shape *treeShape) folderName(index int) string {
+	return shape.name(folderPrefix, index)
+}
+
+//name is prefix + index + .tmp, padded before .tmp to nameLen bytes with the same characters for the same index.
+//the bytes too few for the next multi-byte character are padded with _
+func (shape *treeShape) name(prefix string, index int) string {
+	plain := fmt.Sprintf("%s%d", prefix, index)
+	padLen := shape.nameLen - len(plain) - len("_") - len(nameSuffix)
+	if padLen <= 0 {
+		return plain + nameSuffix
+	}
+
+	var name strings.Builder
+	name.WriteString(plain)
+	name.WriteString("_")
+	for i := 0; padLen > 0; i++ {
+		r := shape.charset[(index*7+i)%len(shape.charset)]
+		if utf8.RuneLen(r) > padLen {
+			name.WriteString(strings.Repeat("_", padLen))
+			break
+		}
+		name.WriteRune(r)
+		padLen -= utf8.RuneLen(r)
+	}
+	name.WriteString(nameSuffix)
+
+	return name.String()
+}
+
+//isGeneratedName tells if name is one name makes with prefix: prefix + index + .tmp, padded or not
+func isGeneratedName(prefix string, name string) bool {
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, nameSuffix) || len(name) < len(prefix)+len(nameSuffix) {
+		return false
+	}
+
+	rest := name[len(prefix) : len(name)-len(nameSuffix)]
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+
+	return digits > 0 && (digits == len(rest) || rest[digits] == '_' && digits+1 < len(rest))
+}
+
+//isGeneratedFile tells if name is a generated file, or one marked as partial by cancelPartialFile
+func isGeneratedFile(name string) bool {
+	if strings.HasPrefix(name, ".") && strings.HasSuffix(name, partialSuffix) {
+		name = name[1 : len(name)-len(partialSuffix)]
+	}
+
+	return isGeneratedName(filePrefix, name)
+}
+
+//subfolders tells whether a folder depth levels below the root gets subfolders
+func (shape *treeShape) subfolders(depth int) bool {
+	return shape.depth < 0 || depth < shape.depth
+}
+
+//makeParentDir creates the missing folders of path below the volume root. with the directory sync policy
+//the new folders are synced into their parents. The volume root itself is never created
+func makeParentDir(ctx context.Context, path string) error {
+	root := GetStringOrDefault(ctx, "volume_root", "")
+	dir := filepath.Dir(path)
+	if root == "" || filepath.Clean(root) == dir {
+		return nil
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := makeParentDir(ctx, dir); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	if getSyncPolicy(ctx).dirs {
+		return syncDir(filepath.Dir(dir))
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+func TestTreeShapeNames(t *testing.T) {
+	shape := defaultTreeShape()
+	if name := shape.fileName(12); name != "file_12.tmp" {
+		t.Error("unexpected", name)
+	}
+	if name := shape.folderName(3); name != "subfolder_3.tmp" {
+		t.Error("unexpected", name)
+	}
+
+	for _, charset := range []string{charsetASCII, charsetSpaces, charsetUnicode} {
+		shape, err := newTreeShape(-1, 10, 500, 40, charset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := shape.fileName(12)
+		if len(name) != 40 || !utf8.ValidString(name) || !strings.HasPrefix(name, "file_12_") || !strings.HasSuffix(name, ".tmp") {
+			t.Error(charset, "unexpected", name)
+		}
+		if name != shape.fileName(12) || name == shape.fileName(13) {
+			t.Error(charset, "names should be the same for the same index only", name)
+		}
+	}
+
+	for _, bad := range []struct{ depth, fanOut, files, nameLen int }{{-2, 10, 500, 0}, {-1, 0, 500, 0}, {-1, 10, 0, 0}, {-1, 10, 500, -1}} {
+		if _, err := newTreeShape(bad.depth, bad.fanOut, bad.files, bad.nameLen, charsetASCII); err == nil {
+			t.Error("expected error for", bad)
+		}
+	}
+	if _, err := newTreeShape(-1, 10, 500, 0, charsetUnicode); err == nil {
+		t.Error("expected error for charset without name length")
+	}
+	if _, err := newTreeShape(-1, 10, 500, 10, "klingon"); err == nil {
+		t.Error("expected error for unknown charset")
+	}
+}
+
+func TestIsGeneratedName(t *testing.T) {
+	shape, _ := newTreeShape(-1, 10, 500, 40, charsetSpaces)
+	for _, name := range []string{"file_0.tmp", "file_12_abc.tmp", shape.fileName(3), ".file_4.tmp.partial"} {
+		if !isGeneratedFile(name) {
+			t.Error("expected generated", name)
+		}
+	}
+	for _, name := range []string{"file_.tmp", "file_x.tmp", "file_1_.tmp", "file_1", "file_1.txt", "notes.tmp", ".file_1.tmp", "subfolder_1.tmp"} {
+		if isGeneratedFile(name) {
+			t.Error("expected not generated", name)
+		}
+	}
+
+	if !isGeneratedName(folderPrefix, shape.folderName(7)) || isGeneratedName(folderPrefix, "subfolder.tmp") {
+		t.Error("unexpected folder names")
+	}
+}
+
+func TestGenerateVolumeTreeShape(t *testing.T) {
+	shape, _ := newTreeShape(2, 2, 3, 0, charsetASCII)
+	ctx := context.WithValue(context.Background(), "tree_shape", shape)
+	ctx = context.WithValue(ctx, "size_profile", histogramProfile(sizeBucket{tempFileSizeConstraint{sizeFormat.KB, sizeFormat.KB}, 1}))
+
+	files := 0
+	for file := range generateVolume(ctx, 1, "build/test", sizeFormat.MB, nil, make(chan error)) {
+		depth := strings.Count(file.path, "subfolder_")
+		if depth > 2 {
+			t.Error("too deep", file.path)
+		}
+		files++
+	}
+
+	// 1 + 2 + 4 folders of 3 files each
+	if files != 21 {
+		t.Error("expected 21 files, got", files)
+	}
+}
+
+func TestMakeParentDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.WithValue(context.Background(), "volume_root", root)
+	ctx = context.WithValue(ctx, "sync_policy", syncPolicy{dirs: true})
+	path := filepath.Join(root, "a", "b", "file_0.tmp")
+	if err := makeParentDir(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		t.Error("expected folder to be created", err)
+	}
+
+	// once there, nothing to do
+	if err := makeParentDir(ctx, path); err != nil {
+		t.Error(err)
+	}
+
+	// the root is not created
+	ctx = context.WithValue(context.Background(), "volume_root", filepath.Join(root, "missing"))
+	if err := makeParentDir(ctx, filepath.Join(root, "missing", "file_0.tmp")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "missing")); !os.IsNotExist(err) {
+		t.Error("root should not have been created", err)
+	}
+}
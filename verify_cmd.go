@@ -13,35 +13,80 @@ import (
 	sizeFormat "github.com/rdev02/size-format"
 )
 
-//VerifyCmd start the generated fs verification process
-func VerifyCmd(ctx context.Context, recorder *IFileRecorder, volumeRoot string, errorChan chan<- error) (*sync.WaitGroup, error) {
-	if recorder == nil {
-		return nil, errors.New("recorder can't be nil")
+//VerifyCmd start the generated fs verification process. The result is populated once the returned WaitGroup is done
+func VerifyCmd(ctx context.Context, recorder *IFileRecorder, volumeRoot string, errorChan chan<- error) (*sync.WaitGroup, *VerifyResult, error) {
+	seeded := GetInt64OrDefault(ctx, "seed", 0) != 0
+	if recorder == nil && !seeded {
+		return nil, nil, errors.New("recorder can't be nil without a content seed")
+	}
+	if onlyRecorded, _ := ctx.Value("only_recorded").(bool); onlyRecorded && recorder == nil && GetStringOrDefault(ctx, "manifest", "") == "" {
+		return nil, nil, errors.New("only the recorded files can be verified without a recorder if there is a manifest")
 	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	chanBuff := GetIntOrDefault(ctx, "max_parallel", 1)
+	ctx = context.WithValue(ctx, "volume_root", volumeRoot)
 
+	result := NewVerifyResult()
 	verificationDoneCh := make(chan interface{})
 	go func() {
 		defer wg.Done()
-		filesDiscovered := verifyVolume(ctx, volumeRoot, errorChan)
+		var filesDiscovered <-chan *TempFile
+		onlyRecorded, _ := ctx.Value("only_recorded").(bool)
+		manifest := GetStringOrDefault(ctx, "manifest", "")
+		if onlyRecorded || (recorder == nil && len(manifest) > 0) {
+			// seeded content is verified against the manifest, if there is one, so the missing and truncated files are found
+			filesDiscovered = recordedFiles(ctx, recorder, volumeRoot, result, errorChan)
+		} else {
+			// without records, only the files named the way they are generated are seeded, not e.g. a manifest stored there
+			filesDiscovered = verifyVolume(ctx, volumeRoot, recorder == nil, errorChan)
+			// the files found are all there is to go by
+			result.Incomplete = recorder == nil
+		}
 
 		var verifyThreads sync.WaitGroup
 		verifyThreads.Add(chanBuff)
 
 		fmt.Println("starting", chanBuff, "verifiers")
 		for i := 0; i < chanBuff; i++ {
-			go verifyFiles(ctx, filesDiscovered, recorder, errorChan, &verifyThreads)
+			go verifyFiles(ctx, filesDiscovered, recorder, result, errorChan, &verifyThreads)
 		}
 
 		verifyThreads.Wait()
 		close(verificationDoneCh)
 
+		if ctx.Err() != nil {
+			// the files not read yet are not missing
+			fmt.Println("verification stopped")
+			result.Print(os.Stdout)
+			return
+		}
+
+		mismatched := len(result.Mismatched)
+		if mismatched > 0 {
+			fmt.Fprintln(os.Stderr, "ERR:", mismatched, "files differ from the seeded content. See above for the offsets")
+		}
+
+		if recorder == nil {
+			result.Print(os.Stdout)
+			missing := len(result.Missing) + len(result.Truncated)
+			switch {
+			case missing > 0:
+				fmt.Fprintln(os.Stderr, "ERR:", missing, "files of the manifest are missing or truncated. See above for the files")
+			case mismatched > 0:
+				// reported above
+			case result.Incomplete:
+				fmt.Fprintln(os.Stderr, "ERR: the files found match the seeded content, but missing or truncated files can't be told without a manifest. Pass the -manifest of the generation")
+			default:
+				fmt.Println("Success: all files were read and match the seeded content")
+			}
+			return
+		}
+
 		remainingFiles, err := (*recorder).FilesNotCheckedYet()
 		if err != nil {
-			errorChan <- fmt.Errorf("could not get missing files %v", err)
+			errorChan <- newFileError(errCategoryRecord, "", fmt.Errorf("could not get missing files %v", err))
 			return
 		}
 
@@ -50,14 +95,27 @@ func VerifyCmd(ctx context.Context, recorder *IFileRecorder, volumeRoot string,
 			for _, file := range remainingFiles {
 				fmt.Fprintln(os.Stderr, file)
 			}
-			fmt.Fprintln(os.Stderr, "ERR: not all files were read/verified. See above for the list of missing/differing files")
-		} else {
+		}
+
+		failedFiles := append(result.corruptedFiles(), remainingFiles...)
+		if len(failedFiles) > 0 {
+			report := NewCorruptionReport(ctx, failedFiles)
+			report.Print(os.Stderr)
+			result.addUnverified(report)
+		}
+
+		result.Print(os.Stdout)
+		if result.Success() {
 			fmt.Println("Success: all files were read and verified")
+		} else {
+			fmt.Fprintln(os.Stderr, "ERR: not all files were read/verified. See above for the missing/differing files")
 		}
 	}()
-	go reportVerificationProgressEveryMinute(ctx, recorder, verificationDoneCh)
+	if recorder != nil {
+		go reportVerificationProgressEveryMinute(ctx, recorder, verificationDoneCh)
+	}
 
-	return &wg, nil
+	return &wg, result, nil
 }
 
 func reportVerificationProgressEveryMinute(ctx context.Context, recorder *IFileRecorder, exit chan interface{}) {
@@ -85,38 +143,100 @@ mainLoop:
 	}
 }
 
-func verifyFiles(ctx context.Context, filesDiscovered <-chan *TempFile, recorder *IFileRecorder, errorChan chan<- error, wg *sync.WaitGroup) {
+func verifyFiles(ctx context.Context, filesDiscovered <-chan *TempFile, recorder *IFileRecorder, result *VerifyResult, errorChan chan<- error, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	rec := *recorder
+	seed := GetInt64OrDefault(ctx, "seed", 0)
+	volumeRoot := GetStringOrDefault(ctx, "volume_root", "")
+	readStats := GetIOStats(ctx, "read_stats")
 
 	for file := range processOrDone(ctx, filesDiscovered) {
 		path := file.path
 
 		fmt.Println("verifying", file.path, sizeFormat.ToString(file.size))
-		fileHash, err := GetFileMd5(path)
+		var fileHash string
+		var err error
+		start := time.Now()
+		// first byte differing from the seeded content, -1 if none
+		mismatch := int64(-1)
+		if seed != 0 {
+			mismatch, fileHash, err = CompareSeeded(ctx, path, NewSeededContent(seed, seededKey(volumeRoot, path)))
+			if err == nil && mismatch >= 0 {
+				fmt.Fprintln(os.Stderr, "ERR: file", path, "differs from the seeded content at offset", mismatch)
+				result.addSeedMismatch(file, mismatch)
+			}
+		} else {
+			fileHash, err = GetFileHash(ctx, path)
+		}
 		if err != nil {
-			errorChan <- err
+			errorChan <- newFileError(errCategoryRead, path, err)
+			markUnreadable(recorder, path)
 			continue
 		}
+		readStats.Record(file.size, time.Since(start))
+		result.addRead(file)
 
 		file.hash = fileHash
-
-		if ok, err := rec.VerifyFileExits(file); !ok || err != nil {
-			fmt.Fprintln(os.Stdout, "WARN: file", path, file.hash, "was not recorded previously", err)
+		if recorder == nil {
+			if mismatch < 0 {
+				result.addVerified(file)
+			}
 			continue
 		}
 
-		_, err = rec.MarkFileExits(file)
-		if err != nil {
+		if err := classifyFile(*recorder, file, result); err != nil {
 			fmt.Fprintln(os.Stderr, "ERR: could not mark file as existing ", path, file.hash)
-			errorChan <- err
-			continue
+			errorChan <- newFileError(errCategoryRecord, path, err)
 		}
 	}
 }
 
-func verifyVolume(ctx context.Context, volumeRoot string, errorChan chan<- error) <-chan *TempFile {
+//markUnreadable marks the recorded file at path, which could not be read, as found: it is reported as a read error, not as missing
+func markUnreadable(recorder *IFileRecorder, path string) {
+	if recorder == nil {
+		return
+	}
+
+	if recorded, err := (*recorder).FindFileByPath(path); err == nil && recorded != nil {
+		(*recorder).MarkPathExists(path)
+	}
+}
+
+//classifyFile looks up what was recorded at the path of file, read back with its hash, and sorts it into
+//verified, corrupted (same size, other hash), truncated (other size) or extraneous (not recorded) files
+func classifyFile(rec IFileRecorder, file *TempFile, result *VerifyResult) error {
+	recorded, err := rec.FindFileByPath(file.path)
+	if err != nil {
+		return err
+	}
+
+	if recorded == nil {
+		fmt.Fprintln(os.Stdout, "WARN: file", file.path, file.hash, "was not recorded previously")
+		result.addExtraneous(file)
+		return nil
+	}
+
+	// found: whatever is wrong with it, it is not missing
+	if _, err := rec.MarkPathExists(file.path); err != nil {
+		return err
+	}
+
+	switch {
+	case recorded.size != file.size:
+		fmt.Fprintln(os.Stderr, "ERR: file", file.path, "is", sizeFormat.ToString(file.size), "instead of", sizeFormat.ToString(recorded.size))
+		result.addTruncated(recorded, file.size)
+	case recorded.hash != file.hash:
+		fmt.Fprintln(os.Stderr, "ERR: file", file.path, "hash", file.hash, "differs from the recorded", recorded.hash)
+		result.addCorrupted(recorded)
+	default:
+		result.addVerified(file)
+	}
+
+	return nil
+}
+
+//verifyVolume sends the non-hidden files below volumeRoot, only the ones with generated names if onlyGenerated
+func verifyVolume(ctx context.Context, volumeRoot string, onlyGenerated bool, errorChan chan<- error) <-chan *TempFile {
 	chanBuff := GetIntOrDefault(ctx, "max_parallel", 1)
 	filesFound := make(chan *TempFile, chanBuff)
 
@@ -127,8 +247,12 @@ func verifyVolume(ctx context.Context, volumeRoot string, errorChan chan<- error
 		filepath.Walk(volumeRoot, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "error reading", path, err)
-				errorChan <- err
-				return err
+				errorChan <- newFileError(errCategoryWalk, path, err)
+				// carry on with the rest of the volume, the error policy decides whether to stop
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
 			}
 
 			select {
@@ -153,6 +277,10 @@ func verifyVolume(ctx context.Context, volumeRoot string, errorChan chan<- error
 				return nil
 			}
 
+			if onlyGenerated && !isGeneratedFile(info.Name()) {
+				return nil
+			}
+
 			file := TempFile{
 				path: path,
 				size: info.Size(),
@@ -168,14 +296,86 @@ func verifyVolume(ctx context.Context, volumeRoot string, errorChan chan<- error
 	return filesFound
 }
 
+//recordedFiles sends the files of the recorder that exist at volumeRoot, instead of walking it, so nothing else is read.
+//Without a recorder the files come from the manifest set by "manifest" in ctx, and the missing and truncated ones are added to result
+func recordedFiles(ctx context.Context, recorder *IFileRecorder, volumeRoot string, result *VerifyResult, errorChan chan<- error) <-chan *TempFile {
+	chanBuff := GetIntOrDefault(ctx, "max_parallel", 1)
+	filesFound := make(chan *TempFile, chanBuff)
+
+	found := func(recorded *TempFile) error {
+		info, err := os.Lstat(recorded.path)
+		switch {
+		case os.IsNotExist(err) && recorder == nil:
+			fmt.Fprintln(os.Stderr, "ERR: file", recorded.path, "is missing")
+			result.addMissing(recorded)
+			return nil
+		case os.IsNotExist(err):
+			// the recorder tells the missing files once all are read
+			return nil
+		case err != nil:
+			errorChan <- newFileError(errCategoryRead, recorded.path, err)
+			markUnreadable(recorder, recorded.path)
+			return nil
+		case !info.Mode().IsRegular():
+			errorChan <- newFileError(errCategoryRead, recorded.path, errors.New("not a regular file"))
+			markUnreadable(recorder, recorded.path)
+			return nil
+		case info.Size() != recorded.size && recorder == nil:
+			fmt.Fprintln(os.Stderr, "ERR: file", recorded.path, "is", sizeFormat.ToString(info.Size()), "instead of", sizeFormat.ToString(recorded.size))
+			result.addTruncated(recorded, info.Size())
+			return nil
+		}
+
+		select {
+		case filesFound <- &TempFile{path: recorded.path, size: info.Size()}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer close(filesFound)
+		fmt.Println("Verifying the recorded files at", volumeRoot)
+
+		if recorder != nil {
+			// nothing is marked before the verification: these are all of them
+			files, err := (*recorder).FilesNotCheckedYet()
+			if err != nil {
+				errorChan <- newFileError(errCategoryRecord, "", err)
+				return
+			}
+			for _, file := range files {
+				if found(file) != nil {
+					return
+				}
+			}
+			return
+		}
+
+		manifest := GetStringOrDefault(ctx, "manifest", "")
+		if _, err := scanManifest(manifest, volumeRoot, found); err != nil && !errors.Is(err, context.Canceled) {
+			errorChan <- newFileError(errCategoryRecord, manifest, err)
+		}
+	}()
+
+	return filesFound
+}
+
+//recordVolume records every written file, also those finished after ctx is cancelled, so they are not lost
 func recordVolume(ctx context.Context, recorder *IFileRecorder, doneQueue <-chan (*TempFile), errorChan chan<- error) {
 	rec := *recorder
 
-	for workItem := range processOrDone(ctx, doneQueue) {
-		err := rec.RecordFile(workItem)
+	var err error
+	for workItem := range doneQueue {
+		// after a failure keep draining, so the writers are not blocked
+		if err != nil {
+			continue
+		}
+
+		err = rec.RecordFile(workItem)
 		if err != nil {
-			errorChan <- err
-			break
+			errorChan <- newFileError(errCategoryRecord, workItem.path, err)
 		}
 	}
 }
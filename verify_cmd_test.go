@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -9,7 +13,7 @@ import (
 func TestVerifyCmd(t *testing.T) {
 	errQ := make(chan error)
 
-	wg, err := VerifyCmd(context.Background(), nil, "./res", errQ)
+	wg, _, err := VerifyCmd(context.Background(), nil, "./res", errQ)
 	if err == nil {
 		t.Error("Expected error on nil recorder")
 	}
@@ -18,7 +22,7 @@ func TestVerifyCmd(t *testing.T) {
 	go func() {
 		defer close(errQ)
 
-		wg, err = VerifyCmd(context.Background(), &recordingStrategy, "./res", errQ)
+		wg, _, err = VerifyCmd(context.Background(), &recordingStrategy, "./res", errQ)
 		if err != nil {
 			t.Error(err)
 		}
@@ -35,9 +39,52 @@ func TestVerifyCmd(t *testing.T) {
 	}
 }
 
+func TestVerifySeededWithoutRecorder(t *testing.T) {
+	root, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"file_0.tmp", "file_1.tmp"} {
+		path := filepath.Join(root, name)
+		if _, _, err := GenerateSeeded(context.Background(), 1000, path, NewSeededContent(42, seededKey(root, path))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(root, "file_1.tmp"), []byte("corrupted"), 0644)
+	// not generated: not seeded either
+	writeTestFiles(t, root, "manifest.jsonl", "disktest.db")
+
+	errQ := make(chan error)
+	ctx := context.WithValue(context.Background(), "seed", int64(42))
+
+	wg, result, err := VerifyCmd(ctx, nil, root, errQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer close(errQ)
+		wg.Wait()
+	}()
+
+	for err := range errQ {
+		t.Error(err)
+	}
+
+	if result.FilesRead != 2 || result.FilesVerified != 1 || len(result.Mismatched) != 1 || result.Success() {
+		t.Error("unexpected result", result.FilesRead, result.FilesVerified, result.Mismatched)
+	}
+	// missing files can't be told without a manifest
+	if !result.Incomplete {
+		t.Error("expected an incomplete verification")
+	}
+}
+
 func TestVerifyVolume(t *testing.T) {
 	errQ := make(chan error)
-	foundFiles := verifyVolume(context.Background(), "./res", errQ)
+	foundFiles := verifyVolume(context.Background(), "./res", false, errQ)
 
 mainLoop:
 	for {
@@ -91,3 +138,210 @@ func TestReportVerificationProgressEveryMinute(t *testing.T) {
 
 	reportVerificationProgressEveryMinute(context.Background(), &rec, exitCH)
 }
+
+func TestVerifyClassifiesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recorder := IFileRecorder(NewInMemRecorder())
+	for _, name := range []string{"ok", "corrupted", "truncated", "missing"} {
+		path := filepath.Join(dir, name)
+		hash, blocks, err := GenerateLen(context.Background(), 3*checksumBlockSize, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder.RecordFile(&TempFile{path: path, size: 3 * checksumBlockSize, hash: hash, blocks: blocks})
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, "corrupted"), os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("corrupted"), checksumBlockSize+5)
+	f.Close()
+	os.Truncate(filepath.Join(dir, "truncated"), checksumBlockSize)
+	os.Remove(filepath.Join(dir, "missing"))
+	ioutil.WriteFile(filepath.Join(dir, "extraneous"), []byte("extra"), 0644)
+
+	errQ := make(chan error)
+	wg, result, err := VerifyCmd(context.Background(), &recorder, dir, errQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer close(errQ)
+		wg.Wait()
+	}()
+
+	for err := range errQ {
+		t.Error(err)
+	}
+
+	if result.FilesVerified != 1 {
+		t.Error("expected 1 verified file, got", result.FilesVerified)
+	}
+	if len(result.Mismatched) != 1 || result.Mismatched[0].Corrupted[0] != [2]int64{checksumBlockSize, 2 * checksumBlockSize} {
+		t.Error("unexpected corrupted files", result.Mismatched)
+	}
+	if len(result.Truncated) != 1 || *result.Truncated[0].ActualSize != checksumBlockSize {
+		t.Error("unexpected truncated files", result.Truncated)
+	}
+	if len(result.Missing) != 1 || filepath.Base(result.Missing[0].Path) != "missing" {
+		t.Error("unexpected missing files", result.Missing)
+	}
+	if len(result.Extraneous) != 1 || filepath.Base(result.Extraneous[0].Path) != "extraneous" {
+		t.Error("unexpected extraneous files", result.Extraneous)
+	}
+}
+
+func TestVerifyOnlyRecorded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recorder := IFileRecorder(NewInMemRecorder())
+	for _, name := range []string{"ok", "truncated", "missing"} {
+		path := filepath.Join(dir, name)
+		hash, blocks, err := GenerateLen(context.Background(), checksumBlockSize, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder.RecordFile(&TempFile{path: path, size: checksumBlockSize, hash: hash, blocks: blocks})
+	}
+	os.Truncate(filepath.Join(dir, "truncated"), 10)
+	os.Remove(filepath.Join(dir, "missing"))
+	ioutil.WriteFile(filepath.Join(dir, "other"), []byte("other data"), 0644)
+
+	errQ := make(chan error)
+	ctx := context.WithValue(context.Background(), "only_recorded", true)
+	wg, result, err := VerifyCmd(ctx, &recorder, dir, errQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer close(errQ)
+		wg.Wait()
+	}()
+
+	for err := range errQ {
+		t.Error(err)
+	}
+
+	if result.FilesRead != 2 || result.FilesVerified != 1 || len(result.Truncated) != 1 || len(result.Missing) != 1 {
+		t.Error("unexpected result", result.FilesRead, result.FilesVerified, result.Truncated, result.Missing)
+	}
+	if len(result.Extraneous) != 0 {
+		t.Error("other data should not be read", result.Extraneous)
+	}
+}
+
+func TestVerifyUnreadable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a folder where a file was recorded can't be read as one
+	path := filepath.Join(dir, "unreadable")
+	os.Mkdir(path, 0755)
+	recorder := IFileRecorder(NewInMemRecorder())
+	recorder.RecordFile(&TempFile{path: path, size: 10, hash: "hash"})
+
+	files := make(chan *TempFile, 1)
+	files <- &TempFile{path: path, size: 10}
+	close(files)
+	errQ := make(chan error, 1)
+	result := NewVerifyResult()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	verifyFiles(context.Background(), files, &recorder, result, errQ, &wg)
+
+	if len(errQ) != 1 {
+		t.Error("expected a read error")
+	}
+	if notChecked, _ := recorder.FilesNotCheckedYet(); len(notChecked) != 0 || result.FilesRead != 0 {
+		t.Error("expected the unreadable file to be reported once, as a read error", notChecked, result.FilesRead)
+	}
+}
+
+func TestVerifyOnlyRecordedSeeded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "volume")
+	os.Mkdir(root, 0755)
+	manifest := filepath.Join(dir, "manifest.jsonl")
+	rec, err := NewManifestRecorder(manifest, root, nil, &manifestHeader{Seed: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ok", "truncated", "missing"} {
+		path := filepath.Join(root, name)
+		hash, blocks, err := GenerateSeeded(context.Background(), 1000, path, NewSeededContent(42, seededKey(root, path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec.RecordFile(&TempFile{path: path, size: 1000, hash: hash, blocks: blocks})
+	}
+	rec.Close()
+	os.Truncate(filepath.Join(root, "truncated"), 10)
+	os.Remove(filepath.Join(root, "missing"))
+	ioutil.WriteFile(filepath.Join(root, "other"), []byte("other data"), 0644)
+
+	ctx := context.WithValue(context.Background(), "seed", int64(42))
+	ctx = context.WithValue(ctx, "only_recorded", true)
+	if _, _, err := VerifyCmd(ctx, nil, root, nil); err == nil {
+		t.Error("expected error without a manifest")
+	}
+
+	errQ := make(chan error)
+	ctx = context.WithValue(ctx, "manifest", manifest)
+	wg, result, err := VerifyCmd(ctx, nil, root, errQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer close(errQ)
+		wg.Wait()
+	}()
+
+	for err := range errQ {
+		t.Error(err)
+	}
+
+	if result.FilesRead != 1 || result.FilesVerified != 1 || len(result.Mismatched) != 0 || len(result.Truncated) != 1 || len(result.Missing) != 1 || result.Success() {
+		t.Error("unexpected result", result.FilesRead, result.FilesVerified, result.Mismatched, result.Truncated, result.Missing)
+	}
+	if result.Incomplete {
+		t.Error("expected a complete verification against the manifest")
+	}
+
+	// the manifest alone is enough to find the missing and truncated files
+	errQ = make(chan error)
+	wg, result, err = VerifyCmd(context.WithValue(ctx, "only_recorded", false), nil, root, errQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer close(errQ)
+		wg.Wait()
+	}()
+	for err := range errQ {
+		t.Error(err)
+	}
+	if len(result.Truncated) != 1 || len(result.Missing) != 1 || result.Incomplete {
+		t.Error("unexpected result", result.Truncated, result.Missing, result.Incomplete)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	sizeFormat "github.com/rdev02/size-format"
+)
+
+type (
+	//VerifyResult holds the outcome of VerifyCmd
+	VerifyResult struct {
+		FilesRead     int64 `json:"files_read"`
+		BytesRead     int64 `json:"bytes_read"`
+		FilesVerified int64 `json:"files_verified"`
+		BytesVerified int64 `json:"bytes_verified"`
+		// recorded files not found on the volume
+		Missing []*reportFile `json:"missing"`
+		// files found on the volume with content other than expected
+		Mismatched []*reportFile `json:"mismatched"`
+		// files found on the volume with a size other than recorded
+		Truncated []*reportFile `json:"truncated"`
+		// files found on the volume, but not recorded
+		Extraneous []*reportFile `json:"extraneous"`
+		// seeded content verified without a manifest: missing and truncated files could not be looked for
+		Incomplete bool `json:"incomplete,omitempty"`
+
+		// recorded versions of the mismatched files, to localize the corruption
+		corrupted []*TempFile
+		lock      sync.Mutex
+	}
+
+	reportFile struct {
+		Path string `json:"path"`
+		Size int64  `json:"size"`
+		Hash string `json:"hash,omitempty"`
+		// size found on the volume, if it differs from the recorded one
+		ActualSize *int64 `json:"actual_size,omitempty"`
+		// first byte differing from the seeded content
+		MismatchOffset *int64     `json:"mismatch_offset,omitempty"`
+		CorruptedBytes int64      `json:"corrupted_bytes,omitempty"`
+		Corrupted      [][2]int64 `json:"corrupted_ranges,omitempty"`
+	}
+)
+
+//NewVerifyResult constructor
+func NewVerifyResult() *VerifyResult {
+	return &VerifyResult{
+		Missing:    make([]*reportFile, 0),
+		Mismatched: make([]*reportFile, 0),
+		Truncated:  make([]*reportFile, 0),
+		Extraneous: make([]*reportFile, 0),
+		corrupted:  make([]*TempFile, 0),
+	}
+}
+
+func newReportFile(file *TempFile) *reportFile {
+	return &reportFile{Path: file.path, Size: file.size, Hash: file.hash}
+}
+
+//Success tells if every recorded file was found and matched. never for an incomplete verification
+func (res *VerifyResult) Success() bool {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	return len(res.Missing) == 0 && len(res.Mismatched) == 0 && len(res.Truncated) == 0 && !res.Incomplete
+}
+
+func (res *VerifyResult) addRead(file *TempFile) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	res.FilesRead++
+	res.BytesRead += file.size
+}
+
+func (res *VerifyResult) addVerified(file *TempFile) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	res.FilesVerified++
+	res.BytesVerified += file.size
+}
+
+//addMissing reports a recorded file not found on the volume
+func (res *VerifyResult) addMissing(recorded *TempFile) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	res.Missing = append(res.Missing, newReportFile(recorded))
+}
+
+func (res *VerifyResult) addExtraneous(file *TempFile) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	res.Extraneous = append(res.Extraneous, newReportFile(file))
+}
+
+//addTruncated reports a file found with a size other than recorded
+func (res *VerifyResult) addTruncated(recorded *TempFile, actualSize int64) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	truncated := newReportFile(recorded)
+	truncated.ActualSize = &actualSize
+	res.Truncated = append(res.Truncated, truncated)
+}
+
+//addCorrupted keeps a file found with the recorded size, but not the recorded hash, until its corruption is analyzed
+func (res *VerifyResult) addCorrupted(recorded *TempFile) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	res.corrupted = append(res.corrupted, recorded)
+}
+
+//corruptedFiles returns the files passed to addCorrupted
+func (res *VerifyResult) corruptedFiles() []*TempFile {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	return append([]*TempFile{}, res.corrupted...)
+}
+
+func (res *VerifyResult) addSeedMismatch(file *TempFile, offset int64) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	mismatch := newReportFile(file)
+	mismatch.MismatchOffset = &offset
+	res.Mismatched = append(res.Mismatched, mismatch)
+}
+
+//addUnverified sorts the analyzed corrupted and missing files into their categories
+func (res *VerifyResult) addUnverified(report *CorruptionReport) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	// seeded verification may have already reported the mismatch
+	reported := make(map[string]bool, len(res.Mismatched))
+	for _, file := range res.Mismatched {
+		reported[file.Path] = true
+	}
+
+	for _, fc := range report.files {
+		file := newReportFile(fc.file)
+		if reported[file.Path] {
+			continue
+		}
+		if fc.missing {
+			res.Missing = append(res.Missing, file)
+			continue
+		}
+
+		file.CorruptedBytes = fc.corrupted
+		for _, r := range fc.ranges {
+			file.Corrupted = append(file.Corrupted, [2]int64{r.from, r.to})
+		}
+		res.Mismatched = append(res.Mismatched, file)
+	}
+}
+
+//Print writes the number of files in every category in a human readable form
+func (res *VerifyResult) Print(w io.Writer) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	fmt.Fprintln(w, "verification:")
+	fmt.Fprintf(w, "  %-10s %6d files %10s\n", "ok", res.FilesVerified, sizeFormat.ToString(res.BytesVerified))
+	for _, category := range []struct {
+		name  string
+		files []*reportFile
+	}{{"corrupted", res.Mismatched}, {"truncated", res.Truncated}, {"missing", res.Missing}, {"extraneous", res.Extraneous}} {
+		size := int64(0)
+		for _, file := range category.files {
+			size += file.Size
+		}
+		fmt.Fprintf(w, "  %-10s %6d files %10s\n", category.name, len(category.files), sizeFormat.ToString(size))
+	}
+	if res.Incomplete {
+		fmt.Fprintln(w, "  incomplete: missing and truncated files were not looked for without a manifest")
+	}
+}
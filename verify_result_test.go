@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyResultAddUnverified(t *testing.T) {
+	res := NewVerifyResult()
+	res.addSeedMismatch(&TempFile{path: "seeded"}, 7)
+
+	res.addUnverified(&CorruptionReport{files: []*fileCorruption{
+		{file: &TempFile{path: "seeded"}, corrupted: 1, ranges: []byteRange{{from: 0, to: 1}}},
+		{file: &TempFile{path: "corrupted"}, corrupted: 2, ranges: []byteRange{{from: 2, to: 4}}},
+		{file: &TempFile{path: "missing"}, missing: true},
+	}})
+
+	if len(res.Missing) != 1 || res.Missing[0].Path != "missing" {
+		t.Error("unexpected missing files", res.Missing)
+	}
+
+	if len(res.Mismatched) != 2 || *res.Mismatched[0].MismatchOffset != 7 || res.Mismatched[1].Corrupted[0] != [2]int64{2, 4} {
+		t.Error("unexpected mismatched files", res.Mismatched)
+	}
+
+	if res.Success() {
+		t.Error("expected failure")
+	}
+}
+
+func TestVerifyResultCategories(t *testing.T) {
+	res := NewVerifyResult()
+	res.addVerified(&TempFile{path: "ok", size: 1})
+	res.addExtraneous(&TempFile{path: "extra", size: 2})
+	if !res.Success() {
+		t.Error("extraneous files alone should not fail verification")
+	}
+
+	res.addTruncated(&TempFile{path: "short", size: 10}, 4)
+	if len(res.Truncated) != 1 || *res.Truncated[0].ActualSize != 4 || res.Truncated[0].Size != 10 {
+		t.Error("unexpected truncated files", res.Truncated)
+	}
+	if res.Success() {
+		t.Error("expected failure")
+	}
+
+	res.addCorrupted(&TempFile{path: "corrupted"})
+	if files := res.corruptedFiles(); len(files) != 1 || files[0].path != "corrupted" {
+		t.Error("unexpected corrupted files", files)
+	}
+
+	var out strings.Builder
+	res.Print(&out)
+	for _, line := range []string{"ok              1 files", "truncated       1 files", "extraneous      1 files"} {
+		if !strings.Contains(out.String(), line) {
+			t.Error("expected", line, "in", out.String())
+		}
+	}
+}